@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/validator"
+)
+
+// readAdminUserParam gets the user id from /v1/admin/users/{id}/permissions
+func (app *application) readAdminUserParam(r *http.Request) (int64, error) {
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/admin/users/")
+
+	idPart, resource, found := strings.Cut(rest, "/")
+	if !found || resource != "permissions" {
+		return 0, errors.New("invalid path")
+	}
+
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+
+	return id, nil
+}
+
+// adminTargetUser loads the user named in the path, writing the error response if it can't
+func (app *application) adminTargetUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readAdminUserParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
+// readPermissionCodes reads {"permissions": ["books:read", ...]} and checks every code is real
+func (app *application) readPermissionCodes(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badJSON(w, r, err)
+		return nil, false
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Permissions) > 0, "permissions", "must contain at least one permission")
+	for _, code := range input.Permissions {
+		v.Check(validator.PermittedValue(code, data.PermissionCodes...), "permissions", "must only contain "+strings.Join(data.PermissionCodes, ", "))
+	}
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return nil, false
+	}
+
+	return input.Permissions, true
+}
+
+func (app *application) listUserPermissions(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeUserPermissions(w, r, user.ID)
+}
+
+func (app *application) grantUserPermissions(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	codes, ok := app.readPermissionCodes(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Permissions.AddForUser(r.Context(), user.ID, codes...)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("permissions granted",
+		"user_id", user.ID,
+		"permissions", codes,
+		"by_user_id", app.contextGetUser(r).ID,
+		"request_id", app.contextGetRequestID(r),
+	)
+
+	app.writeUserPermissions(w, r, user.ID)
+}
+
+func (app *application) revokeUserPermissions(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	codes, ok := app.readPermissionCodes(w, r)
+	if !ok {
+		return
+	}
+
+	//stop the last way back in from being thrown away by accident
+	if user.ID == app.contextGetUser(r).ID && validator.PermittedValue(data.PermissionAdmin, codes...) {
+		app.failedValidation(w, r, map[string]string{"permissions": "you can't revoke your own admin permission"})
+		return
+	}
+
+	err := app.models.Permissions.RemoveForUser(r.Context(), user.ID, codes...)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("permissions revoked",
+		"user_id", user.ID,
+		"permissions", codes,
+		"by_user_id", app.contextGetUser(r).ID,
+		"request_id", app.contextGetRequestID(r),
+	)
+
+	app.writeUserPermissions(w, r, user.ID)
+}
+
+func (app *application) writeUserPermissions(w http.ResponseWriter, r *http.Request, userID int64) {
+	permissions, err := app.models.Permissions.GetAllForUser(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user_id": userID, "permissions": permissions}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
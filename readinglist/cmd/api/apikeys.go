@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/validator"
+)
+
+// createAPIKey makes a new key for the signed in user. The plaintext key is in this response only
+func (app *application) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badJSON(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	key := &data.APIKey{Name: strings.TrimSpace(input.Name), Scopes: input.Scopes}
+
+	v := validator.New()
+
+	if data.ValidateAPIKey(v, key); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	//a key can't do more than the user who made it
+	permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for _, scope := range key.Scopes {
+		v.Check(permissions.Include(scope), "scopes", "must only contain permissions you hold")
+	}
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	key, err = app.models.APIKeys.New(r.Context(), user.ID, key.Name, key.Scopes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("api key created", "api_key_id", key.ID, "user_id", user.ID, "request_id", app.contextGetRequestID(r))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.models.APIKeys.GetAllForUser(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/v1/api-keys/"), 10, 64)
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.APIKeys.Revoke(r.Context(), user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("api key revoked", "api_key_id", id, "user_id", user.ID, "request_id", app.contextGetRequestID(r))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "api key successfully revoked"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
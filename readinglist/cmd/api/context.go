@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"readinglist.github.io/internal/data"
+)
+
+type contextKey string //own type so our keys can't clash with other packages
+
+const (
+	requestIDContextKey = contextKey("requestID")
+	userContextKey      = contextKey("user")
+	apiKeyContextKey    = contextKey("apiKey")
+)
+
+// contextSetRequestID returns a copy of the request with the request ID stored in its context
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the request ID, or "" if the requestID middleware hasn't run
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, ok := r.Context().Value(requestIDContextKey).(string)
+	if !ok {
+		return ""
+	}
+
+	return id
+}
+
+// contextSetUser returns a copy of the request with the user stored in its context
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser is only called after authenticate has run, so a missing user is a bug
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
+
+// contextSetAPIKey records that the request was authenticated with an API key rather than a token
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey returns the API key used for the request, nil when it wasn't made with one
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// logError writes the error along with the request that caused it
+func (app *application) logError(r *http.Request, err error) {
+	app.logger.Error(err.Error(),
+		"method", r.Method,
+		"uri", r.URL.RequestURI(),
+		"request_id", app.contextGetRequestID(r),
+	)
+}
+
+// errorResponse sends a JSON error to the client in the form {"error": message}
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
+	env := envelope{"error": message}
+
+	err := app.writeJSON(w, status, env, nil)
+	if err != nil { //can't send JSON, log it and fall back to an empty 500
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// serverError is used when something unexpected went wrong on our side, the details are logged, not sent.
+// Errors caused by a context ending are split out: a timeout gets a 504, a client that hung up gets nothing
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		app.timeout(w, r, err)
+		return
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+		app.logger.Debug("client closed the request", "uri", r.URL.RequestURI(), "request_id", app.contextGetRequestID(r))
+		return
+	}
+
+	app.logError(r, err)
+
+	message := "the server encountered a problem and could not process your request"
+	app.errorResponse(w, r, http.StatusInternalServerError, message)
+}
+
+// timeout is sent when the database took longer than the query timeout
+func (app *application) timeout(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+
+	message := "the server took too long to process your request, please try again later"
+	app.errorResponse(w, r, http.StatusGatewayTimeout, message)
+}
+
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource could not be found"
+	app.errorResponse(w, r, http.StatusNotFound, message)
+}
+
+func (app *application) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+}
+
+func (app *application) badRequest(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+}
+
+// badJSON reports a readJSON failure, an oversized body gets a 413 and anything else a 400
+func (app *application) badJSON(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		app.errorResponse(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit))
+		return
+	}
+
+	app.badRequest(w, r, err)
+}
+
+// failedValidation sends back a map of field name -> problem so the client knows what to fix
+func (app *application) failedValidation(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+}
+
+func (app *application) editConflict(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the book due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) preconditionFailed(w http.ResponseWriter, r *http.Request) {
+	message := "the book has been modified since you last fetched it, please get the latest version and try again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) invalidCredentials(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) invalidAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) authenticationRequired(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) notPermitted(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) unsupportedPatchType(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Patch", mediaTypeMergePatch+", "+mediaTypeJSONPatch) //RFC 5789, tells the client what we do take
+
+	message := fmt.Sprintf("PATCH bodies must be %s or %s", mediaTypeMergePatch, mediaTypeJSONPatch)
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func (app *application) unsupportedImportType(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Post", mediaTypeCSV+", "+mediaTypeNDJSON)
+
+	message := fmt.Sprintf("imports must be %s or %s", mediaTypeCSV, mediaTypeNDJSON)
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func (app *application) rateLimitExceeded(w http.ResponseWriter, r *http.Request) {
+	message := "rate limit exceeded, please slow down"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+func (app *application) invalidAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "ApiKey")
+
+	message := "invalid or revoked API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) apiKeyNotAllowed(w http.ResponseWriter, r *http.Request) {
+	message := "this resource can't be used with an API key, sign in with an authentication token instead"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
@@ -1,228 +1,348 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
+	"net/url"
 
 	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/validator"
 )
 
-// Return a health check in a json format via manual creation of the json message
+// healthcheck is a quick summary of the running server, see /v1/health/ready for one that checks dependencies
 func (app *application) healthcheck(w http.ResponseWriter, r *http.Request) {
 	//Ensure this is a get method
 	if r.Method != http.MethodGet {
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		app.methodNotAllowed(w, r)
 		return
 	}
 
-	data := map[string]string{ //set message
+	data := envelope{ //set message
 		"status":      "available",
 		"environment": app.config.env,
 		"version":     version,
+		"storage":     app.config.storage,
 	}
 
-	js, err := json.Marshal(data) //encode into json
+	if app.db != nil { //the memory backend has no connection pool
+		stats := app.db.Stats() //live connection pool numbers
+
+		data["database"] = map[string]any{
+			"max_open_connections": stats.MaxOpenConnections,
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration":        stats.WaitDuration.String(),
+			"max_idle_closed":      stats.MaxIdleClosed,
+			"max_idle_time_closed": stats.MaxIdleTimeClosed,
+			"max_lifetime_closed":  stats.MaxLifetimeClosed,
+		}
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, data, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) listBooks(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
 
+	filters := app.readBookFilters(r.URL.Query(), v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := app.models.Books.GetAll(r.Context(), app.contextGetUser(r).ID, filters)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		app.serverError(w, r, err)
 		return
 	}
 
-	js = append(js, '\n') //newline
+	if err := app.writeJSON(w, http.StatusOK, envelope{"books": books, "metadata": metadata}, nil); err != nil { //envelop the json response with books:[]
+		app.serverError(w, r, err)
+	}
+}
 
-	w.Header().Set("Content-Type", "application.json") //set the format type as json
+func (app *application) createBook(w http.ResponseWriter, r *http.Request) {
+	var input bookFields
 
-	w.Write(js) //write the json response
-}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badJSON(w, r, err)
+		return
+	}
 
-func (app *application) getCreateBooksHandler(w http.ResponseWriter, r *http.Request) {
-	//Ensure this is a get method
-	if r.Method == http.MethodGet {
-		books, err := app.models.Books.GetAll()
+	book := &data.Book{UserID: app.contextGetUser(r).ID}
+	input.apply(book)
 
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
+	v := validator.New()
 
-		if err := app.writeJSON(w, http.StatusOK, envelope{"books": books}, nil); err != nil { //envelop the json response with books:[]
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
+	if data.ValidateBook(v, book); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
 	}
 
-	if r.Method == http.MethodPost {
-		var input struct {
-			Title     string   `json:"title"`
-			Published int      `json:"published"`
-			Pages     int      `json:"pages"`
-			Genres    []string `json:"genres"`
-			Rating    float32  `json:"rating"`
-		}
+	err = app.models.Books.Insert(r.Context(), book, app.actor(r)) //pass to create entry
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
-		err := app.readJSON(w, r, &input)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-			return
-		}
+	app.logger.Info("book created", "book_id", book.ID, "request_id", app.contextGetRequestID(r))
 
-		book := &data.Book{
-			Title:     input.Title,
-			Published: input.Published,
-			Pages:     input.Pages,
-			Genres:    input.Genres,
-			Rating:    input.Rating,
-		}
+	headers := make(http.Header) //new header so that we show new ID from the insert call
+	headers.Set("Location", fmt.Sprintf("v1/books/%d", book.ID))
+	headers.Set("ETag", etag(book.Version))
 
-		err = app.models.Books.Insert(book) //pass to create entry
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
+	// Write the JSON response with a 201 Created status code and the Location header set.
+	err = app.writeJSON(w, http.StatusCreated, envelope{"book": book}, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
 
-		headers := make(http.Header) //new header so that we show new ID from the insert call
-		headers.Set("Location", fmt.Sprintf("v1/books/%d", book.ID))
+// getBook returns the book, or with ?version=N the book as it was at that version
+func (app *application) getBook(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
 
-		// Write the JSON response with a 201 Created status code and the Location header set.
-		err = app.writeJSON(w, http.StatusCreated, envelope{"book": book}, headers)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
+	if r.URL.Query().Has("version") {
+		app.getBookVersion(w, r, id)
+		return
+	}
 
+	book, err := app.models.Books.Get(r.Context(), app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
 	}
 
-}
+	headers := make(http.Header) //clients send this back in If-Match when updating
+	headers.Set("ETag", etag(book.Version))
 
-func (app *application) getUpdateDeleteBooksHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		app.getBook(w, r)
-	case http.MethodPut:
-		app.updateBook(w, r)
-	case http.MethodDelete:
-		app.deleteBook(w, r)
-	default:
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	if err := app.writeJSON(w, http.StatusOK, envelope{"book": book}, headers); err != nil {
+		app.serverError(w, r, err)
 	}
 }
 
-func (app *application) getBook(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Path[len("/v1/books/"):]
-	idInt, err := strconv.ParseInt(id, 10, 64) //parse the book id (base 10, 64bit size)
-	if err != nil {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+// getBookVersion has no ETag, an old version can't be updated
+func (app *application) getBookVersion(w http.ResponseWriter, r *http.Request, id int64) {
+	v := validator.New()
+
+	version := app.readInt(r.URL.Query(), "version", 0, v)
+	v.Check(version > 0, "version", "must be greater than zero")
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
 	}
 
-	book, err := app.models.Books.Get(idInt)
+	book, err := app.models.Books.GetVersion(r.Context(), app.contextGetUser(r).ID, id, int32(version))
 	if err != nil {
 		switch {
-		case errors.Is(err, errors.New("record not found")):
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
 		default:
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	if err := app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil); err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+	if err := app.writeJSON(w, http.StatusOK, envelope{"book": book, "version": version}, nil); err != nil {
+		app.serverError(w, r, err)
 	}
 }
 
-func (app *application) updateBook(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Path[len("/v1/books/"):]
-	idInt, err := strconv.ParseInt(id, 10, 64)
+// bookHistory lists every change to a book, oldest first. It still works once the book is deleted
+func (app *application) bookHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
 	if err != nil {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		app.notFound(w, r)
 		return
 	}
 
-	book, err := app.models.Books.Get(idInt)
+	revisions, err := app.models.Books.History(r.Context(), app.contextGetUser(r).ID, id)
 	if err != nil {
 		switch {
-		case errors.Is(err, errors.New("record not found")):
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
 		default:
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	//marshal: Encode an object into a byte slice
-	var input struct { //Defines how to unmarshal (decode into an object)
-		Title     *string  `json:"title"`
-		Published *int     `json:"published"`
-		Pages     *int     `json:"pages"`
-		Genres    []string `json:"genres"`
-		Rating    *float32 `json:"rating"`
+	if err := app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// actor is who to credit a change to in the book history
+func (app *application) actor(r *http.Request) data.Actor {
+	actor := data.Actor{UserID: app.contextGetUser(r).ID}
+	if key := app.contextGetAPIKey(r); key != nil {
+		actor.APIKeyID = key.ID
+	}
+	return actor
+}
+
+// updateBook replaces the whole book, anything left out of the body goes back to its zero value.
+// Use PATCH to change only some fields
+func (app *application) updateBook(w http.ResponseWriter, r *http.Request) {
+	book, ok := app.bookForUpdate(w, r)
+	if !ok {
+		return
 	}
 
-	err = app.readJSON(w, r, &input) //read in the body to parse
+	var input bookFields
+
+	err := app.readJSON(w, r, &input) //read in the body to parse
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		app.badJSON(w, r, err)
 		return
 	}
 
-	//checks if any new information is in the decoded request object
-	if input.Title != nil {
-		book.Title = *input.Title
+	input.apply(book)
+
+	app.saveBook(w, r, book)
+}
+
+// bookFields are the parts of a book a client can write, the body of a create or full update
+type bookFields struct {
+	Title     string   `json:"title"`
+	Published int      `json:"published"`
+	Pages     int      `json:"pages"`
+	Genres    []string `json:"genres"`
+	Rating    float32  `json:"rating"`
+}
+
+func (f bookFields) apply(book *data.Book) {
+	book.Title = f.Title
+	book.Published = f.Published
+	book.Pages = f.Pages
+	book.Genres = f.Genres
+	book.Rating = f.Rating
+
+	if book.Genres == nil { //an empty list clears the genres, same as sending []
+		book.Genres = []string{}
 	}
+}
 
-	if input.Published != nil {
-		book.Published = *input.Published
+// bookForUpdate loads the book being changed and checks the client has the latest version of it.
+// It writes the error response itself, so the caller just returns when ok is false
+func (app *application) bookForUpdate(w http.ResponseWriter, r *http.Request) (*data.Book, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return nil, false
 	}
 
-	if input.Pages != nil {
-		book.Pages = *input.Pages
+	book, err := app.models.Books.Get(r.Context(), app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return nil, false
 	}
 
-	if len(input.Genres) > 0 {
-		book.Genres = input.Genres
+	//the client's copy is out of date, stop before we overwrite someone else's change
+	if !ifMatch(r, book.Version) {
+		app.preconditionFailed(w, r)
+		return nil, false
 	}
 
-	if input.Rating != nil {
-		book.Rating = *input.Rating
+	return book, true
+}
+
+// saveBook validates and writes back a book changed by PUT or PATCH
+func (app *application) saveBook(w http.ResponseWriter, r *http.Request, book *data.Book) {
+	v := validator.New()
+
+	if data.ValidateBook(v, book); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
 	}
 
-	err = app.models.Books.Update(book) //call sql method to update
+	err := app.models.Books.Update(r.Context(), book, app.actor(r)) //call sql method to update
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, data.ErrEditConflict): //someone else updated the book between our read and write
+			app.editConflict(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
-	if err := app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil); err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+	app.logger.Info("book updated", "book_id", book.ID, "version", book.Version, "request_id", app.contextGetRequestID(r))
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(book.Version))
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"book": book}, headers); err != nil {
+		app.serverError(w, r, err)
 	}
 }
 
 func (app *application) deleteBook(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Path[len("/v1/books/"):]
-	idInt, err := strconv.ParseInt(id, 10, 64) //get the id
+	id, err := app.readIDParam(r) //get the id
 	if err != nil {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		app.notFound(w, r)
 		return
 	}
 
-	err = app.models.Books.Delete(idInt) //delete sql call
+	err = app.models.Books.Delete(r.Context(), app.contextGetUser(r).ID, id, app.actor(r)) //delete sql call
 	if err != nil {
 		switch {
-		case errors.Is(err, errors.New("record not found")):
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
 		default:
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "book successfully deleted"}, nil)
+	app.logger.Info("book moved to trash", "book_id", id, "request_id", app.contextGetRequestID(r))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "book moved to trash"}, nil)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		app.serverError(w, r, err)
 	}
 }
+
+// readBookFilters pulls the filtering, sorting and paging options out of the query string
+// e.g. /v1/books?title=dune&genres=scifi&min_rating=4&sort=-rating,title&page=2&page_size=10
+func (app *application) readBookFilters(qs url.Values, v *validator.Validator) data.Filters {
+	var filters data.Filters
+
+	filters.Title = app.readString(qs, "title", "")
+	filters.Genres = app.readCSV(qs, "genres", []string{})
+	filters.Sort = app.readCSV(qs, "sort", []string{"id"})
+	filters.MinRating = app.readFloat(qs, "min_rating", 0, v)
+	filters.PublishedFrom = app.readInt(qs, "published_from", 0, v)
+	filters.PublishedTo = app.readInt(qs, "published_to", 0, v)
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	//only these values are allowed to end up in the ORDER BY clause
+	filters.SortSafelist = []string{
+		"id", "title", "published", "pages", "rating",
+		"-id", "-title", "-published", "-pages", "-rating",
+	}
+
+	return filters
+}
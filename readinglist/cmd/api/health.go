@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// readinessTimeout caps each dependency check so a hung database can't hang the probe too
+const readinessTimeout = 2 * time.Second
+
+// dependencyCheck is one entry in the readiness report
+type dependencyCheck struct {
+	Status  string `json:"status"` //"up" or "down"
+	Latency string `json:"latency,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Current *int64 `json:"current,omitempty"` //only for migrations
+	Latest  *int64 `json:"latest,omitempty"`
+}
+
+// liveness only says the process is running and serving HTTP, it never looks at dependencies
+// so a database outage doesn't get every instance restarted
+func (app *application) liveness(w http.ResponseWriter, r *http.Request) {
+	env := envelope{
+		"status":  "alive",
+		"version": version,
+		"uptime":  time.Since(app.started).Round(time.Second).String(),
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, env, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// readiness says whether this instance should be sent traffic: the database answers, the schema
+// is up to date and we aren't shutting down. Anything else is a 503
+func (app *application) readiness(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]dependencyCheck{}
+
+	if app.db != nil { //the memory backend has nothing to check
+		checks["database"] = app.checkDatabase(r.Context())
+		checks["migrations"] = app.checkSchema(r.Context())
+	}
+
+	status := "ready"
+	for _, check := range checks {
+		if check.Status != "up" {
+			status = "unavailable"
+		}
+	}
+
+	if app.draining.Load() {
+		status = "draining"
+	}
+
+	code := http.StatusOK
+	if status != "ready" {
+		code = http.StatusServiceUnavailable
+	}
+
+	env := envelope{
+		"status":  status,
+		"version": version,
+		"storage": app.config.storage,
+		"uptime":  time.Since(app.started).Round(time.Second).String(),
+		"checks":  checks,
+	}
+
+	if err := app.writeJSON(w, code, env, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) checkDatabase(ctx context.Context) dependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := app.db.PingContext(ctx)
+	check := dependencyCheck{Status: "up", Latency: time.Since(start).String()}
+
+	if err != nil {
+		check.Status = "down"
+		check.Error = err.Error()
+	}
+
+	return check
+}
+
+// checkSchema is down when the database is behind this binary, a newer schema is fine
+// because that is what a rolling deploy looks like from the old instances
+func (app *application) checkSchema(ctx context.Context) dependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	current, err := app.migrator.Version(ctx)
+	latest := app.migrator.Latest()
+	check := dependencyCheck{
+		Status:  "up",
+		Latency: time.Since(start).String(),
+		Current: &current,
+		Latest:  &latest,
+	}
+
+	switch {
+	case err != nil:
+		check.Status = "down"
+		check.Error = err.Error()
+		check.Current = nil
+	case current < latest:
+		check.Status = "down"
+		check.Error = "database has pending migrations"
+	}
+
+	return check
+}
@@ -3,8 +3,14 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"readinglist.github.io/internal/validator"
 )
 
 type envelope map[string]any //envelops the json response under a key
@@ -40,7 +46,40 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	if err := dec.Decode(dst); err != nil {
 		// Custom Error Handling: Alex Edwards, Let's Go Further Chapter 4
 		//Additional note. keeping the credit since I'm writing to a public github
-		return err
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+
+		case errors.Is(err, io.ErrUnexpectedEOF): //Decode can return this for some syntax errors
+			return errors.New("body contains badly-formed JSON")
+
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+
+		case strings.HasPrefix(err.Error(), "json: unknown field "): //no typed error for this one yet
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown key %s", fieldName)
+
+		case errors.As(err, &maxBytesError): //keep the typed error so the handler can send a 413
+			return fmt.Errorf("body must not be larger than %d bytes: %w", maxBytesError.Limit, err)
+
+		case errors.As(err, &invalidUnmarshalError): //we passed a bad dst, that's our bug not the client's
+			panic(err)
+
+		default:
+			return err
+		}
 	}
 
 	err := dec.Decode(&struct{}{}) //Decode the item into a struct
@@ -50,3 +89,112 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 
 	return nil
 }
+
+// readString returns a string value from the query string, or the default if it is not there
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
+}
+
+// readCSV splits a comma separated query string value into a slice
+func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
+	csv := qs.Get(key)
+	if csv == "" {
+		return defaultValue
+	}
+
+	values := []string{}
+	for _, v := range strings.Split(csv, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// readInt converts a query string value to an int, a bad value is recorded in the validator
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// readFloat converts a query string value to a float64, a bad value is recorded in the validator
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+
+	return f
+}
+
+// readBool converts a query string value to a bool, a bad value is recorded in the validator
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return defaultValue
+	}
+
+	return b
+}
+
+// etag builds a strong entity tag from a record version
+func etag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatch reports whether the If-Match header (if there is one) matches the current version
+func ifMatch(r *http.Request, version int32) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || header == "*" {
+		return true
+	}
+
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == current {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readIDParam gets the book id from a /v1/books/{id} or /v1/books/{id}/history path
+func (app *application) readIDParam(r *http.Request) (int64, error) {
+	idPart, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/books/"), "/")
+
+	id, err := strconv.ParseInt(idPart, 10, 64) //parse the book id (base 10, 64bit size)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+
+	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/importer"
+	"readinglist.github.io/internal/validator"
+)
+
+const (
+	mediaTypeCSV    = "text/csv"
+	mediaTypeNDJSON = "application/x-ndjson"
+)
+
+// maxImportBytes is the body limit for an import, bigger than readJSON's since it holds many books
+const maxImportBytes = 8 << 20
+
+// importBooks adds every book in a CSV or NDJSON body and reports what happened to each row.
+// ?format=goodreads or ?format=storygraph reads a CSV library export from those sites instead of our columns.
+// ?dry_run=true only reports, ?mode=best_effort saves the good rows even when others fail,
+// by default (mode=all_or_nothing) one failed row means nothing is saved and the response is a 422
+func (app *application) importBooks(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	dryRun := app.readBool(qs, "dry_run", false, v)
+	mode := app.readString(qs, "mode", "all_or_nothing")
+	format := app.readString(qs, "format", "")
+
+	v.Check(validator.PermittedValue(mode, "all_or_nothing", "best_effort"), "mode", "must be all_or_nothing or best_effort")
+	v.Check(format == "" || validator.PermittedValue(format, importer.Formats...), "format", "must be one of "+strings.Join(importer.Formats, ", "))
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	format, ok := importFormat(r, format)
+	if !ok {
+		app.unsupportedImportType(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	rows, err := importer.Parse(format, r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.errorResponse(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit))
+		default:
+			app.failedValidation(w, r, map[string]string{"body": err.Error()})
+		}
+		return
+	}
+
+	opts := importer.Options{DryRun: dryRun, BestEffort: mode == "best_effort"}
+
+	report, err := importer.Import(r.Context(), app.models.Books, app.contextGetUser(r).ID, app.actor(r), rows, opts)
+	if err != nil {
+		if report == nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		//a best effort import that stopped partway, the report says which books were saved
+		app.logger.Error("import stopped partway", "error", err, "created", report.Created,
+			"request_id", app.contextGetRequestID(r))
+	}
+
+	if report.Created > 0 {
+		app.logger.Info("books imported", "created", report.Created, "skipped", report.Skipped, "failed", report.Failed,
+			"request_id", app.contextGetRequestID(r))
+	}
+
+	status := http.StatusOK
+	if report.RolledBack() {
+		status = http.StatusUnprocessableEntity
+	}
+
+	if err := app.writeJSON(w, status, envelope{"import": report}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// importFormat works out the format from the Content-Type when the client didn't name one,
+// and checks a format it did name matches the body. The exports are all CSV
+func importFormat(r *http.Request, format string) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", false
+	}
+
+	switch mediaType {
+	case mediaTypeCSV:
+		if format == "" {
+			return importer.FormatCSV, true
+		}
+		return format, format != importer.FormatNDJSON
+	case mediaTypeNDJSON, "application/jsonl":
+		return importer.FormatNDJSON, format == "" || format == importer.FormatNDJSON
+	default:
+		return "", false
+	}
+}
+
+const importUsage = "usage: api [flags] import [-format csv|ndjson|goodreads|storygraph] [-dry-run] [-best-effort] EMAIL FILE"
+
+// runImport handles the "import" subcommand, importBooks for an operator with the file on disk,
+// e.g. "api -storage sqlite import -format goodreads reader@example.com goodreads_library_export.csv".
+// A FILE of - reads standard input
+func runImport(cfg config, logger *slog.Logger, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", importer.FormatCSV, "File format ("+strings.Join(importer.Formats, "|")+")")
+	dryRun := fs.Bool("dry-run", false, "Report what would be imported without saving anything")
+	bestEffort := fs.Bool("best-effort", false, "Save the good rows even when others fail")
+
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		return errors.New(importUsage)
+	}
+
+	if !validator.PermittedValue(*format, importer.Formats...) {
+		return fmt.Errorf("unknown format %q (%s)", *format, strings.Join(importer.Formats, "|"))
+	}
+
+	if cfg.storage == "memory" {
+		return errors.New("the memory backend doesn't keep books between runs")
+	}
+
+	email, path := data.NormalizeEmail(fs.Arg(0)), fs.Arg(1)
+
+	file := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		file = f
+	}
+
+	rows, err := importer.Parse(*format, file)
+	if err != nil {
+		return fmt.Errorf("%s %w", path, err) //the parse errors read as "file has ..."
+	}
+
+	models, db, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	user, err := models.Users.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return fmt.Errorf("no user with email %s", email)
+		}
+		return err
+	}
+
+	//no actor, the books weren't added by the user themselves
+	report, err := importer.Import(ctx, models.Books, user.ID, data.Actor{}, rows, importer.Options{DryRun: *dryRun, BestEffort: *bestEffort})
+	if err != nil && report == nil {
+		return err
+	}
+
+	for _, row := range report.Rows {
+		switch row.Status {
+		case importer.StatusFailed:
+			logger.Warn("row failed", "line", row.Line, "title", row.Title, "errors", row.Errors, "reason", row.Reason)
+		case importer.StatusSkipped:
+			logger.Info("row skipped", "line", row.Line, "title", row.Title, "reason", row.Reason)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("import stopped after %d books were created: %w", report.Created, err)
+	}
+
+	if report.RolledBack() {
+		return fmt.Errorf("nothing imported, %d rows failed (use -best-effort to import the rest)", report.Failed)
+	}
+
+	logger.Info("import finished", "user_id", user.ID, "email", user.Email, "dry_run", report.DryRun,
+		"created", report.Created, "skipped", report.Skipped, "failed", report.Failed)
+	return nil
+}
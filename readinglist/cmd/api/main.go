@@ -1,30 +1,86 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/logging"
+	"readinglist.github.io/internal/migrate"
 )
 
 const version = "1.0.0"
 
 type config struct {
-	port int
-	env  string
-	dsn  string
+	port    int
+	env     string
+	storage string
+	db      struct {
+		dsn            string
+		maxOpenConns   int
+		maxIdleConns   int
+		maxIdleTime    time.Duration
+		maxLifetime    time.Duration
+		connectTimeout time.Duration
+		queryTimeout   time.Duration
+		autoMigrate    bool
+	}
+	log struct {
+		format string
+		level  string
+	}
+	auth struct {
+		tokenTTL time.Duration
+	}
+	limiter struct {
+		enabled     bool
+		rps         float64
+		burst       int
+		globalRPS   float64
+		globalBurst int
+		//API keys of trusted services, e.g. the web frontend, that call on behalf of many people
+		serviceKeys  []int64
+		serviceRPS   float64
+		serviceBurst int
+	}
+	cors struct {
+		trustedOrigins   []string
+		allowCredentials bool
+	}
+	trash struct {
+		retention     time.Duration //0 keeps deleted books until someone purges them
+		purgeInterval time.Duration
+	}
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
 }
 
 type application struct {
-	config config
-	logger *log.Logger
-	models data.Models
+	config      config
+	logger      *slog.Logger
+	models      data.Models
+	db          *sql.DB
+	migrator    *migrate.Migrator //nil for the memory backend
+	metrics     *metrics
+	limiter     *rateLimiter //nil when rate limiting is off
+	authLimiter *rateLimiter //failed authentications by IP address, nil when rate limiting is off
+	//the -limiter-service-keys, nil when rate limiting is off
+	serviceLimiter *rateLimiter
+	started        time.Time
+	draining       atomic.Bool    //set once shutdown starts, readiness reports 503 from then on
+	wg             sync.WaitGroup //background goroutines that must finish before we exit
 }
 
 func main() {
@@ -32,49 +88,222 @@ func main() {
 	var cfg config
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "dev", "Environment (dev|stage|prod)")
-	flag.StringVar(&cfg.dsn, "db-dsn", os.Getenv("READINGLIST_DB_DSN"), "PostgreSQL DSN")
+	flag.StringVar(&cfg.storage, "storage", "postgres", "Storage backend (postgres|sqlite|memory)")
+	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("READINGLIST_DB_DSN"), "PostgreSQL DSN, or the database file for sqlite (default readinglist.db)")
+	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "Database max open connections")
+	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "Database max idle connections")
+	flag.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "Database max connection idle time")
+	flag.DurationVar(&cfg.db.maxLifetime, "db-max-lifetime", time.Hour, "Database max connection lifetime")
+	flag.DurationVar(&cfg.db.connectTimeout, "db-connect-timeout", 30*time.Second, "How long to keep retrying the database at startup")
+	flag.DurationVar(&cfg.db.queryTimeout, "db-query-timeout", 3*time.Second, "Default timeout for a single database query")
+	flag.BoolVar(&cfg.db.autoMigrate, "auto-migrate", false, "Apply pending schema migrations on startup")
+	flag.DurationVar(&cfg.auth.tokenTTL, "token-ttl", 24*time.Hour, "How long an authentication token stays valid")
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiting")
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter requests per second for each client")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst for each client")
+	flag.Float64Var(&cfg.limiter.globalRPS, "limiter-global-rps", 100, "Rate limiter requests per second across all clients, 0 for no global limit")
+	flag.IntVar(&cfg.limiter.globalBurst, "limiter-global-burst", 200, "Rate limiter maximum burst across all clients")
+	flag.Func("limiter-service-keys", "IDs of trusted service API keys (space separated), e.g. the web frontend's, limited by -limiter-service-rps and -limiter-service-burst instead", func(val string) error {
+		for _, field := range strings.Fields(val) {
+			id, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || id < 1 {
+				return fmt.Errorf("%q is not an API key ID", field)
+			}
+			cfg.limiter.serviceKeys = append(cfg.limiter.serviceKeys, id)
+		}
+		return nil
+	})
+	flag.Float64Var(&cfg.limiter.serviceRPS, "limiter-service-rps", 50, "Rate limiter requests per second for each service API key")
+	flag.IntVar(&cfg.limiter.serviceBurst, "limiter-service-burst", 100, "Rate limiter maximum burst for each service API key")
+	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated), e.g. \"https://app.example.com http://localhost:5173\"", func(val string) error {
+		cfg.cors.trustedOrigins = strings.Fields(val)
+		return nil
+	})
+	flag.BoolVar(&cfg.cors.allowCredentials, "cors-allow-credentials", false, "Let trusted origins send credentials (cookies or Authorization) on cross-origin requests")
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted books stay in the trash before they are purged, 0 to keep them")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often to purge books that have been in the trash longer than the retention")
+	flag.StringVar(&cfg.log.format, "log-format", "text", "Log output format (text|json)")
+	flag.StringVar(&cfg.log.level, "log-level", "info", "Minimum log level (debug|info|warn|error)")
+	flag.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 30*time.Second, "How long to wait for in-flight requests when shutting down")
+	flag.DurationVar(&cfg.drainDelay, "shutdown-drain-delay", 0, "How long to keep serving, with readiness failing, after a shutdown signal so load balancers can stop sending traffic")
 	flag.Parse()
 
-	//define the logger
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
-
-	//define database
-	db, err := sql.Open("postgres", cfg.dsn)
+	//define the logger, every line carries the environment so the aggregator can tell them apart
+	logger, err := logging.New(os.Stdout, cfg.log.format, cfg.log.level)
 	if err != nil {
-		logger.Fatal(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
+	logger = logger.With("env", cfg.env)
 
-	defer db.Close()
+	if cfg.limiter.enabled && (cfg.limiter.rps <= 0 || cfg.limiter.burst < 1 || cfg.limiter.globalRPS < 0 ||
+		(cfg.limiter.globalRPS > 0 && cfg.limiter.globalBurst < 1) || cfg.limiter.serviceRPS <= 0 || cfg.limiter.serviceBurst < 1) {
+		logger.Error("invalid rate limiter settings, rates must be positive and bursts at least 1")
+		os.Exit(2)
+	}
+
+	//browsers refuse a credentialed response to a wildcard origin, so don't pretend it will work
+	if cfg.cors.allowCredentials && slices.Contains(cfg.cors.trustedOrigins, "*") {
+		logger.Error("-cors-allow-credentials can't be used with a \"*\" trusted origin, list the origins instead")
+		os.Exit(2)
+	}
 
-	err = db.Ping()
+	if cfg.trash.retention < 0 || (cfg.trash.retention > 0 && cfg.trash.purgeInterval <= 0) {
+		logger.Error("invalid trash settings, the retention can't be negative and the purge interval must be positive")
+		os.Exit(2)
+	}
+
+	//subcommands, e.g. "api -storage sqlite migrate up"
+	switch flag.Arg(0) {
+	case "migrate":
+		if err := runMigrate(cfg, logger, flag.Args()[1:]); err != nil {
+			logger.Error("migration failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	case "permissions":
+		if err := runPermissions(cfg, logger, flag.Args()[1:]); err != nil {
+			logger.Error("unable to update permissions", "error", err)
+			os.Exit(1)
+		}
+		return
+	case "import":
+		if err := runImport(cfg, logger, flag.Args()[1:]); err != nil {
+			logger.Error("import failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	//define database
+	models, db, err := openStorage(cfg, logger)
 	if err != nil {
-		logger.Fatal(err)
+		logger.Error("unable to open storage", "storage", cfg.storage, "error", err)
+		os.Exit(1)
 	}
 
-	logger.Printf("database connection pool established")
+	var migrator *migrate.Migrator
+
+	if db != nil {
+		if err := checkMigrations(cfg, logger, db); err != nil {
+			logger.Error("unable to check migrations", "error", err)
+			db.Close()
+			os.Exit(1)
+		}
+
+		migrator, err = migrate.New(db, cfg.storage) //kept for the readiness check
+		if err != nil {
+			logger.Error("unable to load migrations", "error", err)
+			db.Close()
+			os.Exit(1)
+		}
+	}
 
 	//define an app object to store information for each handler
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
+		config:   cfg,
+		logger:   logger,
+		models:   models,
+		db:       db, //nil for the memory backend
+		migrator: migrator,
+		metrics:  newMetrics(),
+		started:  time.Now(),
+	}
+
+	if cfg.limiter.enabled {
+		app.limiter = newRateLimiter(cfg.limiter.rps, cfg.limiter.burst, cfg.limiter.globalRPS, cfg.limiter.globalBurst)
+		app.authLimiter = newRateLimiter(cfg.limiter.rps, cfg.limiter.burst, 0, 0)
+		//a service key is already one bucket for all of its users, so the global limit doesn't apply to it
+		app.serviceLimiter = newRateLimiter(cfg.limiter.serviceRPS, cfg.limiter.serviceBurst, 0, 0)
 	}
 
-	//set the listening port/endpoint
-	addr := fmt.Sprintf(":%d", cfg.port)
+	err = app.serve()
 
-	//create our own mux to prevent modification of global handler
-	srv := &http.Server{
-		Addr:         addr,
-		Handler:      app.route(), //Mux handler
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+	if db != nil {
+		db.Close()
 	}
 
-	//start up the web service using the Server
-	logger.Printf("Starting %s server on %s", cfg.env, addr)
-	err = srv.ListenAndServe()
-	logger.Fatal(err)
+	if err != nil {
+		logger.Error("server error", "error", err)
+		os.Exit(1)
+	}
+}
+
+// openStorage picks the backend from the -storage flag. The *sql.DB is nil for the memory backend
+func openStorage(cfg config, logger *slog.Logger) (data.Models, *sql.DB, error) {
+	switch cfg.storage {
+	case "memory":
+		logger.Warn("using in-memory storage, nothing will be saved when the server stops")
+		return data.NewMemoryModels(), nil, nil
+
+	case "postgres":
+		db, err := openDB("postgres", cfg.db.dsn, cfg, logger)
+		if err != nil {
+			return data.Models{}, nil, err
+		}
+		return data.NewModels(db, cfg.db.queryTimeout), db, nil
+
+	case "sqlite":
+		dsn := cfg.db.dsn
+		if dsn == "" {
+			dsn = "readinglist.db"
+		}
+		//wait on locks instead of failing straight away, WAL lets readers carry on during a write
+		if !strings.Contains(dsn, "_pragma") {
+			dsn = "file:" + dsn + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+		}
+
+		db, err := openDB("sqlite", dsn, cfg, logger)
+		if err != nil {
+			return data.Models{}, nil, err
+		}
+
+		return data.NewSQLiteModels(db, cfg.db.queryTimeout), db, nil
+
+	default:
+		return data.Models{}, nil, fmt.Errorf("unknown storage backend %q (postgres|sqlite|memory)", cfg.storage)
+	}
+}
 
+// openDB sets up the connection pool and waits for the database to answer a ping.
+// When Postgres is starting alongside us it won't be ready yet, so failed pings are
+// retried with exponential backoff until cfg.db.connectTimeout runs out
+func openDB(driver, dsn string, cfg config, logger *slog.Logger) (*sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.db.maxOpenConns)
+	db.SetMaxIdleConns(cfg.db.maxIdleConns)
+	db.SetConnMaxIdleTime(cfg.db.maxIdleTime)
+	db.SetConnMaxLifetime(cfg.db.maxLifetime)
+
+	deadline := time.Now().Add(cfg.db.connectTimeout)
+	backoff := 500 * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) //a single ping shouldn't hang forever
+		err = db.PingContext(ctx)
+		cancel()
+
+		if err == nil {
+			logger.Info("database connection pool established",
+				"driver", driver,
+				"max_open_conns", cfg.db.maxOpenConns,
+				"max_idle_conns", cfg.db.maxIdleConns,
+			)
+			return db, nil
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			db.Close()
+			return nil, fmt.Errorf("database not ready after %d attempts: %w", attempt, err)
+		}
+
+		logger.Warn("database not ready, retrying", "attempt", attempt, "retry_in", backoff, "error", err)
+		time.Sleep(backoff)
+
+		backoff = min(backoff*2, 5*time.Second)
+	}
 }
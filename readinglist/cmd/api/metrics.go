@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the histogram upper bounds in seconds, the same defaults the Prometheus clients use
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// knownRoutes are the only route labels we report, anything else is counted as "unmatched" so
+// a scanner trying thousands of made up paths can't blow up the number of series
+var knownRoutes = map[string]bool{
+	"/metrics":                         true,
+	"/v1/healthcheck":                  true,
+	"/v1/health/live":                  true,
+	"/v1/health/ready":                 true,
+	"/v1/books":                        true,
+	"/v1/books/import":                 true,
+	"/v1/books/{id}":                   true,
+	"/v1/books/{id}/history":           true,
+	"/v1/books/{id}/restore":           true,
+	"/v1/trash":                        true,
+	"/v1/trash/{id}":                   true,
+	"/v1/users":                        true,
+	"/v1/tokens/authentication":        true,
+	"/v1/api-keys":                     true,
+	"/v1/api-keys/{id}":                true,
+	"/v1/admin/users/{id}/permissions": true,
+}
+
+// routeLabel turns a request path into its route pattern, e.g. /v1/books/123 becomes /v1/books/{id}
+func routeLabel(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if _, err := strconv.ParseInt(segment, 10, 64); err == nil {
+			segments[i] = "{id}"
+		}
+	}
+
+	route := "/" + strings.Join(segments, "/")
+	if !knownRoutes[route] {
+		return "unmatched"
+	}
+	return route
+}
+
+// methodLabel keeps the method label to the methods we actually serve
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "other"
+	}
+}
+
+type requestKey struct {
+	route, method string
+	status        int
+}
+
+type latencyKey struct {
+	route, method string
+}
+
+type histogram struct {
+	counts []uint64 //one per bucket, not cumulative, the +Inf bucket is count
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(seconds float64) {
+	for i, upper := range latencyBuckets {
+		if seconds <= upper {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// metrics collects the request numbers for the /metrics endpoint
+type metrics struct {
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	latencies map[latencyKey]*histogram
+	inFlight  atomic.Int64
+	started   time.Time
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:  make(map[requestKey]uint64),
+		latencies: make(map[latencyKey]*histogram),
+		started:   time.Now(),
+	}
+}
+
+func (m *metrics) observe(route, method string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{route, method, status}]++
+
+	key := latencyKey{route, method}
+	h, ok := m.latencies[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latencies[key] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// recordMetrics counts every request, including the ones rejected by later middleware
+func (app *application) recordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		app.metrics.inFlight.Add(1)
+		defer app.metrics.inFlight.Add(-1)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		app.metrics.observe(routeLabel(r.URL.Path), methodLabel(r.Method), rec.status, time.Since(start))
+	})
+}
+
+// metricsHandler writes everything out in the Prometheus text exposition format
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	m := app.metrics
+	m.mu.Lock()
+
+	writeHeader(out, "readinglist_http_requests_total", "counter", "Total HTTP requests by route, method and status.")
+	requestKeys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	for _, key := range requestKeys {
+		fmt.Fprintf(out, "readinglist_http_requests_total{route=%q,method=%q,status=\"%d\"} %d\n",
+			key.route, key.method, key.status, m.requests[key])
+	}
+
+	writeHeader(out, "readinglist_http_request_duration_seconds", "histogram", "HTTP request latency by route and method.")
+	latencyKeys := make([]latencyKey, 0, len(m.latencies))
+	for key := range m.latencies {
+		latencyKeys = append(latencyKeys, key)
+	}
+	sort.Slice(latencyKeys, func(i, j int) bool {
+		a, b := latencyKeys[i], latencyKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		return a.method < b.method
+	})
+	for _, key := range latencyKeys {
+		h := m.latencies[key]
+		labels := fmt.Sprintf("route=%q,method=%q", key.route, key.method)
+
+		var cumulative uint64
+		for i, upper := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(out, "readinglist_http_request_duration_seconds_bucket{%s,le=%q} %d\n",
+				labels, formatFloat(upper), cumulative)
+		}
+		fmt.Fprintf(out, "readinglist_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(out, "readinglist_http_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(h.sum))
+		fmt.Fprintf(out, "readinglist_http_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	m.mu.Unlock()
+
+	writeHeader(out, "readinglist_http_requests_in_flight", "gauge", "HTTP requests currently being served.")
+	fmt.Fprintf(out, "readinglist_http_requests_in_flight %d\n", m.inFlight.Load())
+
+	if app.db != nil { //the memory backend has no connection pool
+		stats := app.db.Stats()
+
+		gauges := []struct {
+			name, help string
+			value      int
+		}{
+			{"readinglist_db_max_open_connections", "Maximum number of open connections to the database.", stats.MaxOpenConnections},
+			{"readinglist_db_open_connections", "Established connections, both in use and idle.", stats.OpenConnections},
+			{"readinglist_db_in_use_connections", "Connections currently in use.", stats.InUse},
+			{"readinglist_db_idle_connections", "Idle connections.", stats.Idle},
+		}
+		for _, g := range gauges {
+			writeHeader(out, g.name, "gauge", g.help)
+			fmt.Fprintf(out, "%s %d\n", g.name, g.value)
+		}
+
+		counters := []struct {
+			name, help string
+			value      int64
+		}{
+			{"readinglist_db_wait_count_total", "Connections waited for because the pool was full.", stats.WaitCount},
+			{"readinglist_db_max_idle_closed_total", "Connections closed because of the max idle limit.", stats.MaxIdleClosed},
+			{"readinglist_db_max_idle_time_closed_total", "Connections closed because of the max idle time.", stats.MaxIdleTimeClosed},
+			{"readinglist_db_max_lifetime_closed_total", "Connections closed because of the max lifetime.", stats.MaxLifetimeClosed},
+		}
+		for _, c := range counters {
+			writeHeader(out, c.name, "counter", c.help)
+			fmt.Fprintf(out, "%s %d\n", c.name, c.value)
+		}
+
+		writeHeader(out, "readinglist_db_wait_duration_seconds_total", "counter", "Total time spent waiting for a connection.")
+		fmt.Fprintf(out, "readinglist_db_wait_duration_seconds_total %s\n", formatFloat(stats.WaitDuration.Seconds()))
+	}
+
+	writeHeader(out, "readinglist_build_info", "gauge", "Build information, the value is always 1.")
+	fmt.Fprintf(out, "readinglist_build_info{version=%q,goversion=%q,storage=%q} 1\n", version, runtime.Version(), app.config.storage)
+
+	writeHeader(out, "readinglist_start_time_seconds", "gauge", "Unix time the server started.")
+	fmt.Fprintf(out, "readinglist_start_time_seconds %d\n", m.started.Unix())
+}
+
+func writeHeader(out *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
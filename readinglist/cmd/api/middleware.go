@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/validator"
+)
+
+// middleware wraps a handler with extra behaviour
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h so the first middleware listed is the outermost (runs first)
+func chain(h http.Handler, m ...middleware) http.Handler {
+	for i := len(m) - 1; i >= 0; i-- {
+		h = m[i](h)
+	}
+	return h
+}
+
+// recoverPanic turns a panic in a handler into a JSON 500 instead of a dropped connection
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { //runs as the stack unwinds from a panic
+			if err := recover(); err != nil {
+				w.Header().Set("Connection", "close") //tell Go's server to close the connection after the response
+				app.serverError(w, r, fmt.Errorf("%s", err))
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDPattern limits what we will accept from a client's X-Request-ID so junk doesn't end up in our logs
+var requestIDPattern = regexp.MustCompile(`^[a-zA-Z0-9._\-]{1,128}$`)
+
+// requestID reuses the caller's X-Request-ID if it sent a sane one, otherwise generates a new one.
+// The ID is stored in the request context and echoed back in the response header
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		r = app.contextSetRequestID(r, id)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil { //should never happen, fall back to something unique enough
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status code and size of the response for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader { //Write without WriteHeader means an implicit 200
+		rec.WriteHeader(http.StatusOK)
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the real ResponseWriter
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logRequest writes one access log line per request once the response is done
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		app.logger.Info("request",
+			"method", r.Method,
+			"path", r.URL.RequestURI(),
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration", time.Since(start),
+			"request_id", app.contextGetRequestID(r),
+		)
+	})
+}
+
+// authenticate looks for an "Authorization: Bearer <token>" or "Authorization: ApiKey <key>" header
+// and puts the matching user in the request context. No header means the anonymous user,
+// bad credentials are rejected with a 401
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization") //responses differ by who is asking
+
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Fields(authorizationHeader)
+		if len(headerParts) == 2 && strings.EqualFold(headerParts[0], "ApiKey") {
+			app.authenticateAPIKey(next, w, r, headerParts[1])
+			return
+		}
+
+		if len(headerParts) != 2 || !strings.EqualFold(headerParts[0], "Bearer") {
+			app.invalidAuthenticationToken(w, r)
+			return
+		}
+
+		token := headerParts[1]
+
+		v := validator.New()
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationToken(w, r)
+			return
+		}
+
+		user, err := app.models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationToken(w, r)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiKeyTouchInterval stops a busy service from writing last_used_at on every single request
+const apiKeyTouchInterval = time.Minute
+
+// authenticateAPIKey is the ApiKey half of authenticate, the key's owner becomes the request's user
+func (app *application) authenticateAPIKey(next http.Handler, w http.ResponseWriter, r *http.Request, plaintext string) {
+	v := validator.New()
+	if data.ValidateAPIKeyPlaintext(v, plaintext); !v.Valid() {
+		app.invalidAPIKey(w, r)
+		return
+	}
+
+	key, err := app.models.APIKeys.GetByKey(r.Context(), plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAPIKey(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.Get(r.Context(), key.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAPIKey(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyTouchInterval {
+		app.background(func() {
+			if err := app.models.APIKeys.Touch(context.Background(), key.ID); err != nil {
+				app.logger.Error("unable to record API key use", "api_key_id", key.ID, "error", err)
+			}
+		})
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetAPIKey(r, key)
+	next.ServeHTTP(w, r)
+}
+
+// requireAuthenticatedUser wraps the handlers that change data
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequired(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requirePermission only lets authenticated users holding the permission code through.
+// A request made with an API key also needs the code in the key's scopes
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if key := app.contextGetAPIKey(r); key != nil && !slices.Contains(key.Scopes, code) {
+			app.notPermitted(w, r)
+			return
+		}
+
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			app.notPermitted(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// requireUserToken is for handlers a service shouldn't reach, e.g. minting more API keys
+func (app *application) requireUserToken(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetAPIKey(r) != nil {
+			app.apiKeyNotAllowed(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// the CORS response headers for a preflight, kept in one place so they line up with the routes
+var (
+	corsAllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+	corsAllowedHeaders = []string{"Authorization", "Content-Type", "If-Match", "X-Request-ID"}
+	corsExposedHeaders = []string{"ETag", "Location", "X-Request-ID", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"}
+)
+
+// enableCORS lets pages served from a trusted origin call the API from the browser.
+// Requests from any other origin are served as normal, the browser just won't hand the response to the page
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	trusted := app.config.cors.trustedOrigins
+	anyOrigin := slices.Contains(trusted, "*")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//the response depends on these, caches must not hand one origin's answer to another
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+
+		if origin == "" || !(anyOrigin || slices.Contains(trusted, origin)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if app.config.cors.allowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+
+		//a preflight asks permission before the real request, answer it here without auth or rate limiting
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsAllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", "600")
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
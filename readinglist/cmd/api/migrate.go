@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"readinglist.github.io/internal/migrate"
+)
+
+const migrateUsage = "usage: api [flags] migrate up|down|status|goto N"
+
+// runMigrate handles the "migrate" subcommand, args are whatever came after "migrate"
+func runMigrate(cfg config, logger *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if cfg.storage == "memory" {
+		return errors.New("the memory backend has no schema to migrate")
+	}
+
+	_, db, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, cfg.storage)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		ran, err := m.Up(ctx)
+		return reportMigration(logger, "applied", ran, err)
+
+	case "down":
+		version, err := m.Down(ctx)
+		return reportMigration(logger, "rolled back", []int64{version}, err)
+
+	case "goto":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid migration version %q", args[1])
+		}
+
+		ran, err := m.Goto(ctx, version)
+		return reportMigration(logger, "ran", ran, err)
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+func reportMigration(logger *slog.Logger, action string, versions []int64, err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		logger.Info("database schema already up to date")
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	logger.Info("migrations "+action, "versions", versions)
+	return nil
+}
+
+// checkMigrations runs at startup, with -auto-migrate it applies anything pending,
+// otherwise it warns so nobody is surprised by a missing column
+func checkMigrations(cfg config, logger *slog.Logger, db *sql.DB) error {
+	m, err := migrate.New(db, cfg.storage)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	if cfg.db.autoMigrate {
+		ran, err := m.Up(ctx)
+		return reportMigration(logger, "applied", ran, err)
+	}
+
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current < m.Latest() {
+		logger.Warn("database has pending migrations, run \"api migrate up\" or start with -auto-migrate",
+			"current", current, "latest", m.Latest())
+	}
+
+	return nil
+}
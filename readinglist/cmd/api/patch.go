@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/jsonpatch"
+)
+
+const (
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+// patchBook changes part of a book. The body is either a merge patch (RFC 7396), e.g.
+// {"rating": 4, "genres": null} to set the rating and clear the genres, or a JSON Patch (RFC 6902), e.g.
+// [{"op": "test", "path": "/genres/0", "value": "scifi"}, {"op": "add", "path": "/genres/-", "value": "classic"}]
+func (app *application) patchBook(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != mediaTypeMergePatch && mediaType != mediaTypeJSONPatch) {
+		app.unsupportedPatchType(w, r)
+		return
+	}
+
+	book, ok := app.bookForUpdate(w, r)
+	if !ok {
+		return
+	}
+
+	doc, err := bookDocument(book)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var patched any
+
+	switch mediaType {
+	case mediaTypeMergePatch:
+		var patch map[string]any //a patch that isn't an object would replace the whole book
+		if err := app.readJSON(w, r, &patch); err != nil {
+			app.badJSON(w, r, err)
+			return
+		}
+		patched = jsonpatch.MergePatch(doc, patch)
+
+	case mediaTypeJSONPatch:
+		var ops []jsonpatch.Operation
+		if err := app.readJSON(w, r, &ops); err != nil {
+			app.badJSON(w, r, err)
+			return
+		}
+
+		patched, err = jsonpatch.Apply(doc, ops)
+		if err != nil {
+			switch {
+			case errors.Is(err, jsonpatch.ErrTestFailed):
+				app.errorResponse(w, r, http.StatusConflict, err.Error())
+			default:
+				app.failedValidation(w, r, map[string]string{"patch": err.Error()})
+			}
+			return
+		}
+	}
+
+	fields, err := readBookDocument(patched)
+	if err != nil {
+		app.failedValidation(w, r, map[string]string{"patch": err.Error()})
+		return
+	}
+
+	fields.apply(book)
+
+	app.saveBook(w, r, book)
+}
+
+// bookDocument is the book as the generic JSON the patch functions work on, with the same
+// field names and types a client sends when creating one
+func bookDocument(book *data.Book) (any, error) {
+	js, err := json.Marshal(bookFields{
+		Title:     book.Title,
+		Published: book.Published,
+		Pages:     book.Pages,
+		Genres:    book.Genres,
+		Rating:    book.Rating,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var doc any
+	err = json.Unmarshal(js, &doc)
+	return doc, err
+}
+
+// readBookDocument turns the patched document back into fields, rejecting anything that
+// isn't a book such as an unknown key or a title that is now a number
+func readBookDocument(doc any) (bookFields, error) {
+	var fields bookFields
+
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return fields, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&fields); err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			return fields, fmt.Errorf("result has the wrong JSON type for field %q", unmarshalTypeError.Field)
+		case errors.As(err, &unmarshalTypeError):
+			return fields, errors.New("result must be a JSON object")
+		default:
+			return fields, fmt.Errorf("result is not a valid book: %s", strings.TrimPrefix(err.Error(), "json: "))
+		}
+	}
+
+	return fields, nil
+}
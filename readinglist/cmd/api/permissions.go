@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/validator"
+)
+
+const permissionsUsage = "usage: api [flags] permissions grant|revoke EMAIL CODE..."
+
+// runPermissions handles the "permissions" subcommand. It is how the first admin gets made,
+// after that admins can use the /v1/admin endpoints
+func runPermissions(cfg config, logger *slog.Logger, args []string) error {
+	if len(args) < 3 {
+		return errors.New(permissionsUsage)
+	}
+
+	action, email, codes := args[0], data.NormalizeEmail(args[1]), args[2:]
+
+	for _, code := range codes {
+		if !validator.PermittedValue(code, data.PermissionCodes...) {
+			return fmt.Errorf("unknown permission %q (%s)", code, strings.Join(data.PermissionCodes, "|"))
+		}
+	}
+
+	if cfg.storage == "memory" {
+		return errors.New("the memory backend doesn't keep users between runs")
+	}
+
+	models, db, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	user, err := models.Users.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return fmt.Errorf("no user with email %s", email)
+		}
+		return err
+	}
+
+	switch action {
+	case "grant":
+		err = models.Permissions.AddForUser(ctx, user.ID, codes...)
+	case "revoke":
+		err = models.Permissions.RemoveForUser(ctx, user.ID, codes...)
+	default:
+		return errors.New(permissionsUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	permissions, err := models.Permissions.GetAllForUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("permissions updated", "user_id", user.ID, "email", user.Email, "permissions", permissions)
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket holds up to burst tokens and refills at rps tokens a second, each request takes one
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill tops the bucket up for the time since it was last touched
+func (b *tokenBucket) refill(now time.Time, rps float64, burst int) {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rps)
+	b.last = now
+}
+
+// wait is how long until the bucket has n tokens
+func (b *tokenBucket) wait(n, rps float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / rps * float64(time.Second))
+}
+
+// rateLimiter keeps one bucket per client plus a global bucket shared by everyone.
+// A request has to get a token from both, so one busy client can't starve the rest
+// and all the clients together can't swamp the database
+type rateLimiter struct {
+	mu sync.Mutex
+
+	rps   float64
+	burst int
+
+	global      *tokenBucket //nil when there is no global limit
+	globalRPS   float64
+	globalBurst int
+
+	clients map[string]*tokenBucket
+}
+
+// rateLimitResult is what the middleware needs to fill in the RateLimit-* headers
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration //until the client's bucket is full again
+	retryAfter time.Duration //until the next request would be allowed
+}
+
+func newRateLimiter(rps float64, burst int, globalRPS float64, globalBurst int) *rateLimiter {
+	l := &rateLimiter{
+		rps:         rps,
+		burst:       burst,
+		globalRPS:   globalRPS,
+		globalBurst: globalBurst,
+		clients:     make(map[string]*tokenBucket),
+	}
+
+	if globalRPS > 0 {
+		l.global = &tokenBucket{tokens: float64(globalBurst), last: time.Now()}
+	}
+
+	return l
+}
+
+// allow takes a token for the client if both its bucket and the global one have one to give
+func (l *rateLimiter) allow(key string, now time.Time) rateLimitResult {
+	return l.check(key, now, true)
+}
+
+// peek says whether allow would let the client through, without taking anything
+func (l *rateLimiter) peek(key string, now time.Time) rateLimitResult {
+	return l.check(key, now, false)
+}
+
+func (l *rateLimiter) check(key string, now time.Time, take bool) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.clients[key] = client
+	}
+	client.refill(now, l.rps, l.burst)
+
+	retryAfter := client.wait(1, l.rps)
+
+	if l.global != nil {
+		l.global.refill(now, l.globalRPS, l.globalBurst)
+		retryAfter = max(retryAfter, l.global.wait(1, l.globalRPS))
+	}
+
+	result := rateLimitResult{allowed: retryAfter == 0, retryAfter: retryAfter}
+
+	//only take the tokens once we know the request is going through
+	if result.allowed && take {
+		client.tokens--
+		if l.global != nil {
+			l.global.tokens--
+		}
+	}
+
+	result.remaining = int(client.tokens)
+	result.reset = client.wait(float64(l.burst), l.rps)
+
+	return result
+}
+
+// evict forgets clients that haven't been seen for idle, by then their bucket would be full anyway
+func (l *rateLimiter) evict(now time.Time, idle time.Duration) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	evicted := 0
+	for key, client := range l.clients {
+		if now.Sub(client.last) > idle {
+			delete(l.clients, key)
+			evicted++
+		}
+	}
+
+	return evicted
+}
+
+// evictRateLimits forgets idle clients once a minute until ctx is cancelled
+func (app *application) evictRateLimits(ctx context.Context) {
+	cfg := app.config.limiter
+
+	//a bucket left alone this long has refilled completely, so forgetting it changes nothing
+	idle := max(3*time.Minute, time.Duration(float64(cfg.burst)/cfg.rps*float64(time.Second)),
+		time.Duration(float64(cfg.serviceBurst)/cfg.serviceRPS*float64(time.Second)))
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n := app.limiter.evict(now, idle) + app.authLimiter.evict(now, idle) + app.serviceLimiter.evict(now, idle); n > 0 {
+				app.logger.Debug("evicted idle rate limit buckets", "count", n)
+			}
+		}
+	}
+}
+
+// rateLimit rejects requests over the configured rate with a 429. It runs after authenticate so
+// signed in users and API keys get their own bucket wherever they connect from, everyone else is
+// limited by IP address
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	if app.limiter == nil {
+		return next
+	}
+
+	cfg := app.config.limiter
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//probes and scrapes come on a schedule, a 429 there would just look like an outage
+		if strings.HasPrefix(r.URL.Path, "/v1/health/") || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limiter, burst := app.limiter, cfg.burst
+		if key := app.contextGetAPIKey(r); key != nil && slices.Contains(cfg.serviceKeys, key.ID) {
+			limiter, burst = app.serviceLimiter, cfg.serviceBurst
+		}
+
+		result := limiter.allow(app.rateLimitKey(r), time.Now())
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+
+		if !result.allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.retryAfter)))
+			app.rateLimitExceeded(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitAuthFailures charges every failed sign in, bad token and bad API key to the caller's IP address.
+// It runs before authenticate, which turns a bad credential away before rateLimit sees the request, and
+// once an address has failed too often its credentials aren't even looked up until its bucket refills.
+// The failures have their own buckets, so a signed in user isn't held back by anonymous traffic from
+// the same address
+func (app *application) limitAuthFailures(next http.Handler) http.Handler {
+	if app.authLimiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && r.URL.Path != "/v1/tokens/authentication" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "ip:" + clientIP(r)
+
+		if result := app.authLimiter.peek(key, time.Now()); !result.allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.retryAfter)))
+			app.rateLimitExceeded(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == http.StatusUnauthorized {
+			app.authLimiter.allow(key, time.Now())
+		}
+	})
+}
+
+// rateLimitKey picks which bucket a request draws from
+func (app *application) rateLimitKey(r *http.Request) string {
+	if key := app.contextGetAPIKey(r); key != nil {
+		return fmt.Sprintf("api_key:%d", key.ID)
+	}
+
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+
+	return "ip:" + clientIP(r)
+}
+
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// ceilSeconds rounds up so a client never retries a moment too early
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
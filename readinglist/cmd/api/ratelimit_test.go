@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func assertResult(t *testing.T, got rateLimitResult, allowed bool, remaining int, retryAfter time.Duration) {
+	t.Helper()
+
+	if got.allowed != allowed || got.remaining != remaining || got.retryAfter != retryAfter {
+		t.Errorf("got allowed=%v remaining=%d retry after %s, want %v, %d and %s",
+			got.allowed, got.remaining, got.retryAfter, allowed, remaining, retryAfter)
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	l := newRateLimiter(1, 3, 0, 0)
+	now := time.Now()
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		assertResult(t, l.allow("ip:1", now), true, remaining, 0)
+	}
+
+	result := l.allow("ip:1", now)
+	assertResult(t, result, false, 0, time.Second)
+	if result.reset != 3*time.Second {
+		t.Errorf("reset: got %s, want 3s for the whole burst to come back", result.reset)
+	}
+
+	//other clients have their own bucket
+	assertResult(t, l.allow("ip:2", now), true, 2, 0)
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	l := newRateLimiter(2, 4, 0, 0)
+	now := time.Now()
+
+	for i := 0; i < 4; i++ {
+		l.allow("ip:1", now)
+	}
+	assertResult(t, l.allow("ip:1", now), false, 0, 500*time.Millisecond)
+
+	//1.5 tokens back after 750ms, one is taken and half a token is left
+	now = now.Add(750 * time.Millisecond)
+	assertResult(t, l.allow("ip:1", now), true, 0, 0)
+	assertResult(t, l.allow("ip:1", now), false, 0, 250*time.Millisecond)
+
+	//a bucket left alone for long only fills up to the burst
+	now = now.Add(time.Hour)
+	assertResult(t, l.allow("ip:1", now), true, 3, 0)
+}
+
+func TestRateLimiterGlobal(t *testing.T) {
+	l := newRateLimiter(10, 2, 1, 1)
+	now := time.Now()
+
+	assertResult(t, l.allow("ip:1", now), true, 1, 0)
+
+	//the global bucket is empty, so ip:2 is turned away without losing a token of its own
+	assertResult(t, l.allow("ip:2", now), false, 2, time.Second)
+	assertResult(t, l.allow("ip:2", now), false, 2, time.Second)
+
+	now = now.Add(time.Second)
+	assertResult(t, l.allow("ip:2", now), true, 1, 0)
+}
+
+func TestRateLimiterPeek(t *testing.T) {
+	l := newRateLimiter(1, 2, 1, 2)
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		assertResult(t, l.peek("ip:1", now), true, 2, 0)
+	}
+
+	l.allow("ip:1", now)
+	l.allow("ip:1", now)
+	assertResult(t, l.peek("ip:1", now), false, 0, time.Second)
+}
+
+func TestRateLimiterEvict(t *testing.T) {
+	l := newRateLimiter(1, 2, 0, 0)
+	now := time.Now()
+
+	l.allow("ip:1", now)
+	l.allow("ip:1", now)
+	l.allow("ip:2", now.Add(2*time.Minute))
+
+	if n := l.evict(now.Add(3*time.Minute), time.Minute); n != 1 {
+		t.Fatalf("evicted %d buckets, want 1", n)
+	}
+	if _, ok := l.clients["ip:1"]; ok {
+		t.Error("ip:1 is still there after being idle for 3 minutes")
+	}
+	if _, ok := l.clients["ip:2"]; !ok {
+		t.Error("ip:2 was evicted after 1 minute, which isn't more than the idle time")
+	}
+
+	//an evicted client comes back to a full bucket, as it would have had anyway
+	assertResult(t, l.allow("ip:1", now.Add(3*time.Minute)), true, 1, 0)
+}
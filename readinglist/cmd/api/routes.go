@@ -2,12 +2,124 @@ package main
 
 import (
 	"net/http"
+	"sort"
+	"strings"
+
+	"readinglist.github.io/internal/data"
 )
 
-func (app *application) route() *http.ServeMux {
+func (app *application) route() http.Handler {
 	mux := http.NewServeMux()
+	mux.HandleFunc("/", app.notFound) //anything not matched below gets a JSON 404
 	mux.HandleFunc("/v1/healthcheck", app.healthcheck)
-	mux.HandleFunc("/v1/books", app.getCreateBooksHandler)
-	mux.HandleFunc("/v1/books/", app.getUpdateDeleteBooksHandler)
-	return mux
+	mux.Handle("/v1/health/live", app.methods(methodHandlers{
+		http.MethodGet: app.liveness,
+	}))
+	mux.Handle("/v1/health/ready", app.methods(methodHandlers{
+		http.MethodGet: app.readiness,
+	}))
+	mux.Handle("/metrics", app.methods(methodHandlers{
+		http.MethodGet: app.metricsHandler,
+	}))
+
+	//every user has their own reading list, reading it and changing it are separate permissions
+	mux.Handle("/v1/books", app.methods(methodHandlers{
+		http.MethodGet:  app.requirePermission(data.PermissionBooksRead, app.listBooks),
+		http.MethodPost: app.requirePermission(data.PermissionBooksWrite, app.createBook),
+	}))
+	mux.Handle("/v1/books/import", app.methods(methodHandlers{
+		http.MethodPost: app.requirePermission(data.PermissionBooksWrite, app.importBooks),
+	}))
+	mux.Handle("/v1/books/", app.subresources("/v1/books/", map[string]http.Handler{
+		"": app.methods(methodHandlers{
+			http.MethodGet:    app.requirePermission(data.PermissionBooksRead, app.getBook),
+			http.MethodPut:    app.requirePermission(data.PermissionBooksWrite, app.updateBook),
+			http.MethodPatch:  app.requirePermission(data.PermissionBooksWrite, app.patchBook),
+			http.MethodDelete: app.requirePermission(data.PermissionBooksWrite, app.deleteBook),
+		}),
+		"history": app.methods(methodHandlers{
+			http.MethodGet: app.requirePermission(data.PermissionBooksRead, app.bookHistory),
+		}),
+		"restore": app.methods(methodHandlers{
+			http.MethodPost: app.requirePermission(data.PermissionBooksWrite, app.restoreBook),
+		}),
+	}))
+
+	//deleted books wait in the trash until they are restored, purged by an admin or too old to keep
+	mux.Handle("/v1/trash", app.methods(methodHandlers{
+		http.MethodGet: app.requirePermission(data.PermissionBooksRead, app.listTrash),
+	}))
+	mux.Handle("/v1/trash/", app.methods(methodHandlers{
+		http.MethodDelete: app.requirePermission(data.PermissionAdmin, app.purgeBook),
+	}))
+
+	mux.Handle("/v1/users", app.methods(methodHandlers{
+		http.MethodPost: app.registerUser,
+	}))
+	mux.Handle("/v1/tokens/authentication", app.methods(methodHandlers{
+		http.MethodPost: app.createAuthenticationToken,
+	}))
+
+	//keys for services such as cmd/web, managing them needs a real sign in rather than another key
+	mux.Handle("/v1/api-keys", app.methods(methodHandlers{
+		http.MethodGet:  app.requireUserToken(app.listAPIKeys),
+		http.MethodPost: app.requireUserToken(app.createAPIKey),
+	}))
+	mux.Handle("/v1/api-keys/", app.methods(methodHandlers{
+		http.MethodDelete: app.requireUserToken(app.revokeAPIKey),
+	}))
+
+	//GET/POST/DELETE /v1/admin/users/{id}/permissions
+	mux.Handle("/v1/admin/users/", app.methods(methodHandlers{
+		http.MethodGet:    app.requirePermission(data.PermissionAdmin, app.listUserPermissions),
+		http.MethodPost:   app.requirePermission(data.PermissionAdmin, app.grantUserPermissions),
+		http.MethodDelete: app.requirePermission(data.PermissionAdmin, app.revokeUserPermissions),
+	}))
+
+	//requestID runs first so everything after it (including panics) can be tied to the request,
+	//recordMetrics sits outside the rest so rejected and panicking requests are counted too,
+	//enableCORS answers preflights before they can be rejected for having no credentials,
+	//limitAuthFailures wraps authenticate so bad credentials are limited too,
+	//rateLimit comes after authenticate so it can tell users and API keys apart
+	return chain(mux, app.requestID, app.recordMetrics, app.logRequest, app.recoverPanic, app.enableCORS,
+		app.limitAuthFailures, app.authenticate, app.rateLimit)
+}
+
+// subresources routes prefix/{id} to handlers[""] and prefix/{id}/name to handlers["name"],
+// the handlers parse the id themselves
+func (app *application) subresources(prefix string, handlers map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+		handler, ok := handlers[name]
+		if !ok {
+			app.notFound(w, r)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// methodHandlers maps an HTTP method to the handler for it on one path
+type methodHandlers map[string]http.HandlerFunc
+
+// methods sends the request to the handler for its method, or a 405 listing the allowed ones
+func (app *application) methods(handlers methodHandlers) http.Handler {
+	allowed := make([]string, 0, len(handlers))
+	for method := range handlers {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.Method]
+		if !ok {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			app.methodNotAllowed(w, r)
+			return
+		}
+
+		handler(w, r)
+	})
 }
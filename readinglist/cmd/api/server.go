@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve runs the HTTP server until it fails or gets SIGINT/SIGTERM, in which case it
+// stops taking new connections, lets in-flight requests and background tasks finish, and returns nil
+func (app *application) serve() error {
+	//set the listening port/endpoint
+	addr := fmt.Sprintf(":%d", app.config.port)
+
+	//create our own mux to prevent modification of global handler
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      app.route(), //Mux handler
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+	}
+
+	//jobs like the trash purger run until shutdown, they have to be stopped before waiting on the background tasks
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	if app.config.trash.retention > 0 {
+		app.background(func() {
+			app.purgeTrash(jobs)
+		})
+	}
+
+	if app.limiter != nil {
+		app.background(func() {
+			app.evictRateLimits(jobs)
+		})
+	}
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit //blocks until a signal comes in
+
+		app.logger.Info("shutting down server", "signal", s.String(), "timeout", app.config.shutdownTimeout)
+
+		//fail readiness first, then give the load balancer a moment to notice before we stop listening
+		app.draining.Store(true)
+		if app.config.drainDelay > 0 {
+			app.logger.Info("draining", "delay", app.config.drainDelay)
+			time.Sleep(app.config.drainDelay)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
+		defer cancel()
+
+		//Shutdown makes ListenAndServe return http.ErrServerClosed straight away, then waits for open requests.
+		//even if it times out the jobs are stopped and the background tasks finished before we report it
+		err := srv.Shutdown(ctx)
+
+		app.logger.Info("completing background tasks")
+		stopJobs()
+		app.wg.Wait()
+		shutdownError <- err
+	}()
+
+	//start up the web service using the Server
+	app.logger.Info("starting server", "addr", addr, "version", version)
+
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("stopped server", "addr", addr)
+
+	return nil
+}
+
+// background runs fn in a goroutine that shutdown will wait for, a panic is logged rather than crashing the server
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error("background task panicked", "error", fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
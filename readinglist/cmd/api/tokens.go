@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/validator"
+)
+
+// createAuthenticationToken swaps an email and password for a bearer token
+func (app *application) createAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badJSON(w, r, err)
+		return
+	}
+
+	input.Email = data.NormalizeEmail(input.Email)
+
+	v := validator.New()
+
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlaintext(v, input.Password)
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound): //same answer as a wrong password so emails can't be probed
+			app.invalidCredentials(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !match {
+		app.invalidCredentials(w, r)
+		return
+	}
+
+	token, err := app.models.Tokens.New(r.Context(), user.ID, app.config.auth.tokenTTL, data.ScopeAuthentication)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("authentication token issued", "user_id", user.ID, "request_id", app.contextGetRequestID(r))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
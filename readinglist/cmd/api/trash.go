@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/validator"
+)
+
+// listTrash is listBooks for the books the user has deleted, they take the same filters
+func (app *application) listTrash(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	filters := app.readBookFilters(r.URL.Query(), v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+	filters.Trashed = true
+
+	books, metadata, err := app.models.Books.GetAll(r.Context(), app.contextGetUser(r).ID, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"books": books, "metadata": metadata}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) restoreBook(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	book, err := app.models.Books.Restore(r.Context(), app.contextGetUser(r).ID, id, app.actor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("book restored", "book_id", id, "request_id", app.contextGetRequestID(r))
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(book.Version))
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"book": book}, headers); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// purgeBook deletes a book in anyone's trash for good, books that aren't in the trash are left alone
+func (app *application) purgeBook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/v1/trash/"), 10, 64)
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.models.Books.Purge(r.Context(), id, app.actor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("book purged", "book_id", id, "request_id", app.contextGetRequestID(r))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "book permanently deleted"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// purgeTrash empties the trash of books deleted more than the retention ago, once at startup
+// and then every purge interval until ctx is cancelled
+func (app *application) purgeTrash(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().Add(-app.config.trash.retention)
+
+		n, err := app.models.Books.PurgeTrash(ctx, cutoff)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			app.logger.Error("purging trash", "error", err)
+		case n > 0:
+			app.logger.Info("purged trash", "count", n, "deleted_before", cutoff.UTC().Format(time.RFC3339))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
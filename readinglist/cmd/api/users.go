@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/validator"
+)
+
+// registerUser creates an account from {"name", "email", "password"}
+func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badJSON(w, r, err)
+		return
+	}
+
+	user := &data.User{
+		Name:  input.Name,
+		Email: data.NormalizeEmail(input.Email),
+	}
+
+	v := validator.New()
+
+	//every field is checked before the password is hashed, bcrypt refuses passwords over 72 bytes
+	data.ValidateUserDetails(v, user)
+	data.ValidatePasswordPlaintext(v, input.Password)
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = user.Password.Set(input.Password) //hash with bcrypt before it goes anywhere
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Insert(r.Context(), user, data.DefaultPermissions...)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidation(w, r, v.Errors)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("user registered", "user_id", user.ID, "request_id", app.contextGetRequestID(r))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"html/template"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -18,6 +17,7 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
 	books, err := app.readinglist.GetAll() //gets all the books in the DB (Will call webservice)
 	if err != nil {
+		app.logger.Error("unable to list books", "error", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -30,14 +30,14 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
 	ts, err := template.ParseFiles(files...) //parse the html files
 	if err != nil {
-		log.Print(err.Error())
+		app.logger.Error("unable to parse templates", "error", err)
 		http.Error(w, "Internal Server Error", 500)
 		return
 	}
 
 	err = ts.ExecuteTemplate(w, "base", books) //execute the templates in ts, executes base first, pass in books found in DB
 	if err != nil {
-		log.Print(err.Error())
+		app.logger.Error("unable to render template", "error", err)
 		http.Error(w, "Internal server error", 500)
 		return
 	}
@@ -52,6 +52,7 @@ func (app *application) bookView(w http.ResponseWriter, r *http.Request) {
 
 	book, err := app.readinglist.Get(int64(id)) //get the book from web service call
 	if err != nil {
+		app.logger.Error("unable to get book", "book_id", id, "error", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -67,14 +68,14 @@ func (app *application) bookView(w http.ResponseWriter, r *http.Request) {
 
 	ts, err := template.New("showBook").Funcs(funcs).ParseFiles(files...) //parse the html files and adds template functions
 	if err != nil {
-		log.Println(err)
+		app.logger.Error("unable to parse templates", "error", err)
 		http.Error(w, "Internal Server Error", 500)
 		return
 	}
 
 	err = ts.ExecuteTemplate(w, "base", book) //execute the HTML pages, start with base, and then populate with the book data
 	if err != nil {
-		log.Println(err)
+		app.logger.Error("unable to render template", "book_id", id, "error", err)
 		http.Error(w, "Internal Server Error", 500)
 		return
 	}
@@ -101,13 +102,13 @@ func (app *application) bookCreateForm(w http.ResponseWriter, r *http.Request) {
 
 	ts, err := template.ParseFiles(files...) //parse html and adds templates to ts
 	if err != nil {
-		log.Println(err)
+		app.logger.Error("unable to parse templates", "error", err)
 		http.Error(w, "Internal Server Error", 500)
 		return
 	}
 	err = ts.ExecuteTemplate(w, "base", nil) //execute the template with no data
 	if err != nil {
-		log.Println(err)
+		app.logger.Error("unable to render template", "error", err)
 		http.Error(w, "Internal Server Error", 500)
 		return
 	}
@@ -116,7 +117,7 @@ func (app *application) bookCreateForm(w http.ResponseWriter, r *http.Request) {
 func (app *application) bookCreateProcess(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm() //parse the form that we just submitted for later population below
 	if err != nil {
-		log.Println(err)
+		app.logger.Warn("unable to parse form", "error", err)
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
@@ -159,23 +160,30 @@ func (app *application) bookCreateProcess(w http.ResponseWriter, r *http.Request
 
 	data, err := json.Marshal(book) //encode into json
 	if err != nil {
+		app.logger.Error("unable to encode book", "error", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	req, _ := http.NewRequest("POST", app.readinglist.Endpoint, bytes.NewBuffer(data)) //create post request to api
+	req, err := app.readinglist.NewRequest(http.MethodPost, app.readinglist.Endpoint, bytes.NewBuffer(data)) //create post request to api
+	if err != nil {
+		app.logger.Error("unable to build the API request", "endpoint", app.readinglist.Endpoint, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{}
 	resp, err := client.Do(req) //calls API
 	if err != nil {
+		app.logger.Error("unable to reach the API", "endpoint", app.readinglist.Endpoint, "error", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	defer resp.Body.Close() //defer the closing of connection
 
 	if resp.StatusCode != http.StatusCreated { //display if bad response
-		log.Printf("unexpected status: %s", resp.Status)
+		app.logger.Error("unexpected status from the API", "status", resp.Status)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// liveness is 200 as long as the process is serving HTTP
+func (app *application) liveness(w http.ResponseWriter, r *http.Request) {
+	app.writeHealth(w, http.StatusOK, map[string]any{
+		"status": "alive",
+		"uptime": time.Since(app.started).Round(time.Second).String(),
+	})
+}
+
+// readiness checks the API behind -endpoint is ready and takes our credential, the pages are useless without it
+func (app *application) readiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := app.readinglist.Ping(ctx)
+
+	api := map[string]any{
+		"status":   "up",
+		"endpoint": app.readinglist.Endpoint,
+		"latency":  time.Since(start).String(),
+	}
+
+	status, code := "ready", http.StatusOK
+	if err != nil {
+		api["status"] = "down"
+		api["error"] = err.Error()
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	if app.draining.Load() {
+		status, code = "draining", http.StatusServiceUnavailable
+	}
+
+	app.writeHealth(w, code, map[string]any{
+		"status": status,
+		"uptime": time.Since(app.started).Round(time.Second).String(),
+		"checks": map[string]any{"api": api},
+	})
+}
+
+func (app *application) writeHealth(w http.ResponseWriter, status int, body map[string]any) {
+	js, err := json.Marshal(body)
+	if err != nil {
+		app.logger.Error("unable to encode health response", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
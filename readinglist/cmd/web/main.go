@@ -2,30 +2,52 @@ package main
 
 import (
 	"flag"
-	"log"
-	"net/http"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
 
+	"readinglist.github.io/internal/logging"
 	"readinglist.github.io/internal/models"
 )
 
 type application struct {
+	logger      *slog.Logger
 	readinglist *models.ReadingListModel
+	started     time.Time
+	draining    atomic.Bool //set once shutdown starts so readiness fails
 }
 
 func main() {
 	addr := flag.String("addr", ":80", "HTTP network address")
 	endpoint := flag.String("endpoint", "http://localhost:4000/v1/books", "Endpoint for the readlingList web service")
+	apiKey := flag.String("api-key", os.Getenv("READINGLIST_API_KEY"), "API key the web frontend uses to call the readinglist API, list its ID in the API's -limiter-service-keys as every visitor shares it")
+	logFormat := flag.String("log-format", "text", "Log output format (text|json)")
+	logLevel := flag.String("log-level", "info", "Minimum log level (debug|info|warn|error)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "How long to wait for in-flight requests when shutting down")
+	drainDelay := flag.Duration("shutdown-drain-delay", 0, "How long to keep serving, with readiness failing, after a shutdown signal")
+	flag.Parse()
 
-	app := &application{
-		readinglist: &models.ReadingListModel{Endpoint: *endpoint},
+	logger, err := logging.New(os.Stdout, *logFormat, *logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	srv := &http.Server{
-		Addr:    *addr,
-		Handler: app.routes(),
+	if *apiKey == "" {
+		logger.Warn("no API key set, requests to the API will be rejected until -api-key or READINGLIST_API_KEY is given")
 	}
 
-	log.Printf("Starting the server on %s", *addr)
-	err := srv.ListenAndServe()
-	log.Fatal(err)
+	app := &application{
+		logger:      logger,
+		readinglist: &models.ReadingListModel{Endpoint: *endpoint, APIKey: *apiKey},
+		started:     time.Now(),
+	}
+
+	err = app.serve(*addr, *shutdownTimeout, *drainDelay)
+	if err != nil {
+		logger.Error("server error", "error", err)
+		os.Exit(1)
+	}
 }
@@ -12,5 +12,8 @@ func (app *application) routes() *http.ServeMux {
 	mux.HandleFunc("/book/view", app.bookView)
 	mux.HandleFunc("/book/create", app.bookCreate)
 
+	mux.HandleFunc("/health/live", app.liveness)
+	mux.HandleFunc("/health/ready", app.readiness)
+
 	return mux
 }
@@ -0,0 +1,287 @@
+package data
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memoryAccounts holds users and everything hanging off them for the memory backend.
+// The user and token models share it so a token lookup can find its user
+type memoryAccounts struct {
+	mu         sync.RWMutex
+	users      map[int64]*User
+	nextUserID int64
+	tokens     map[[sha256.Size]byte]*Token
+	perms      map[int64]Permissions
+	apiKeys    map[int64]*APIKey
+	nextKeyID  int64
+}
+
+func newMemoryAccounts() *memoryAccounts {
+	return &memoryAccounts{
+		users:      make(map[int64]*User),
+		nextUserID: 1,
+		tokens:     make(map[[sha256.Size]byte]*Token),
+		perms:      make(map[int64]Permissions),
+		apiKeys:    make(map[int64]*APIKey),
+		nextKeyID:  1,
+	}
+}
+
+// MemoryUserModel is the memory UserStore
+type MemoryUserModel struct {
+	*memoryAccounts
+}
+
+func (m MemoryUserModel) Insert(ctx context.Context, user *User, permissions ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.users {
+		if existing.Email == user.Email {
+			return ErrDuplicateEmail
+		}
+	}
+
+	user.ID = m.nextUserID
+	user.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	user.Version = 1
+	m.nextUserID++
+
+	stored := *user
+	stored.Password.plaintext = nil //never keep the plaintext around
+	m.users[user.ID] = &stored
+
+	for _, code := range permissions {
+		if slices.Contains(PermissionCodes, code) && !m.perms[user.ID].Include(code) {
+			m.perms[user.ID] = append(m.perms[user.ID], code)
+		}
+	}
+
+	return nil
+}
+
+func (m MemoryUserModel) Get(ctx context.Context, id int64) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	u := *user
+	return &u, nil
+}
+
+func (m MemoryUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.Email == email {
+			u := *user
+			return &u, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MemoryUserModel) GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	token, ok := m.tokens[sha256.Sum256([]byte(tokenPlaintext))]
+	if !ok || token.Scope != scope || !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	user, ok := m.users[token.UserID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	u := *user
+	return &u, nil
+}
+
+// MemoryTokenModel is the memory TokenStore
+type MemoryTokenModel struct {
+	*memoryAccounts
+}
+
+func (m MemoryTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *token
+	stored.Plaintext = "" //like the SQL backends, only the hash is kept
+	m.tokens[[sha256.Size]byte(token.Hash)] = &stored
+
+	return token, nil
+}
+
+func (m MemoryTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, token := range m.tokens {
+		if token.Scope == scope && token.UserID == userID {
+			delete(m.tokens, hash)
+		}
+	}
+
+	return nil
+}
+
+// MemoryPermissionModel is the memory PermissionStore
+type MemoryPermissionModel struct {
+	*memoryAccounts
+}
+
+func (m MemoryPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	permissions := slices.Clone(m.perms[userID])
+	if permissions == nil {
+		permissions = Permissions{}
+	}
+	slices.Sort(permissions)
+
+	return permissions, nil
+}
+
+func (m MemoryPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, code := range codes {
+		if slices.Contains(PermissionCodes, code) && !m.perms[userID].Include(code) {
+			m.perms[userID] = append(m.perms[userID], code)
+		}
+	}
+
+	return nil
+}
+
+func (m MemoryPermissionModel) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.perms[userID] = slices.DeleteFunc(m.perms[userID], func(code string) bool {
+		return slices.Contains(codes, code)
+	})
+
+	return nil
+}
+
+// MemoryAPIKeyModel is the memory APIKeyStore
+type MemoryAPIKeyModel struct {
+	*memoryAccounts
+}
+
+func (m MemoryAPIKeyModel) New(ctx context.Context, userID int64, name string, scopes []string) (*APIKey, error) {
+	key, err := generateAPIKey(userID, name, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key.ID = m.nextKeyID
+	m.nextKeyID++
+
+	stored := *key
+	stored.Plaintext = ""
+	stored.Scopes = slices.Clone(scopes)
+	m.apiKeys[key.ID] = &stored
+
+	return key, nil
+}
+
+func (m MemoryAPIKeyModel) GetByKey(ctx context.Context, plaintext string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hash := hashAPIKey(plaintext)
+	for _, key := range m.apiKeys {
+		if !key.Revoked() && bytes.Equal(key.Hash, hash) {
+			return copyAPIKey(key), nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MemoryAPIKeyModel) GetAllForUser(ctx context.Context, userID int64) ([]*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []*APIKey{}
+	for _, key := range m.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+
+	slices.SortFunc(keys, func(a, b *APIKey) int { //newest first, like the SQL backends
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	return keys, nil
+}
+
+func (m MemoryAPIKeyModel) Revoke(ctx context.Context, userID, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok || key.UserID != userID || key.Revoked() {
+		return ErrRecordNotFound
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	key.RevokedAt = &now
+
+	return nil
+}
+
+func (m MemoryAPIKeyModel) Touch(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key, ok := m.apiKeys[id]; ok {
+		now := time.Now().UTC().Truncate(time.Second)
+		key.LastUsedAt = &now
+	}
+
+	return nil
+}
+
+// copyAPIKey stops callers from changing the stored key through the pointers it holds
+func copyAPIKey(key *APIKey) *APIKey {
+	k := *key
+	k.Scopes = slices.Clone(key.Scopes)
+	if key.LastUsedAt != nil {
+		t := *key.LastUsedAt
+		k.LastUsedAt = &t
+	}
+	if key.RevokedAt != nil {
+		t := *key.RevokedAt
+		k.RevokedAt = &t
+	}
+	return &k
+}
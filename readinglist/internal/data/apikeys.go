@@ -0,0 +1,233 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"readinglist.github.io/internal/validator"
+)
+
+// apiKeyPrefix marks a string as one of our API keys so a leaked key is easy to grep for
+const apiKeyPrefix = "rlk_"
+
+// APIKey is a long-lived credential for a service acting on behalf of its owner.
+// A key can only use the permissions listed in Scopes, and only while the owner still holds them
+type APIKey struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Plaintext  string     `json:"key,omitempty"` //only set on the response that created the key
+	Hash       []byte     `json:"-"`
+}
+
+// Revoked reports whether the key has been revoked
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// generateAPIKey makes a random key like "rlk_" followed by 32 base32 characters
+func generateAPIKey(userID int64, name string, scopes []string) (*APIKey, error) {
+	key := &APIKey{
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+	}
+
+	randomBytes := make([]byte, 20)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+
+	key.Plaintext = apiKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	key.Hash = hashAPIKey(key.Plaintext)
+
+	return key, nil
+}
+
+func hashAPIKey(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(strings.TrimSpace(key.Name) != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(key.Scopes) > 0, "scopes", "must contain at least one permission")
+	v.Check(validator.Unique(key.Scopes), "scopes", "must not contain duplicate values")
+	for _, scope := range key.Scopes {
+		v.Check(validator.PermittedValue(scope, PermissionCodes...), "scopes", "must only contain "+strings.Join(PermissionCodes, ", "))
+	}
+}
+
+func ValidateAPIKeyPlaintext(v *validator.Validator, plaintext string) {
+	v.Check(strings.HasPrefix(plaintext, apiKeyPrefix), "key", "must be an API key")
+	v.Check(len(plaintext) == len(apiKeyPrefix)+32, "key", "must be 36 bytes long")
+}
+
+// APIKeyModel is the SQL APIKeyStore, the queries work on both PostgreSQL and SQLite.
+// Scopes are kept as a comma separated string so the same column type works for both
+type APIKeyModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// New creates a key for the user and saves it, the returned key is the only copy of the plaintext
+func (m APIKeyModel) New(ctx context.Context, userID int64, name string, scopes []string) (*APIKey, error) {
+	key, err := generateAPIKey(userID, name, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO api_keys (created_at, user_id, name, hash, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	args := []interface{}{key.CreatedAt, key.UserID, key.Name, key.Hash, strings.Join(key.Scopes, ",")}
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return key, nil
+}
+
+// GetByKey finds an unrevoked key from its plaintext
+func (m APIKeyModel) GetByKey(ctx context.Context, plaintext string) (*APIKey, error) {
+	query := `
+		SELECT id, created_at, user_id, name, scopes, last_used_at, revoked_at
+		FROM api_keys
+		WHERE hash = $1 AND revoked_at IS NULL`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	key, err := scanAPIKey(m.DB.QueryRowContext(ctx, query, hashAPIKey(plaintext)))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return key, nil
+}
+
+// GetAllForUser lists a user's keys, revoked ones included, newest first
+func (m APIKeyModel) GetAllForUser(ctx context.Context, userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT id, created_at, user_id, name, scopes, last_used_at, revoked_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id DESC`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return keys, nil
+}
+
+// Revoke stops one of the user's keys from working, an already revoked key counts as not found
+func (m APIKeyModel) Revoke(ctx context.Context, userID, id int64) error {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().UTC().Truncate(time.Second), id, userID)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Touch records that the key has just been used
+func (m APIKeyModel) Touch(ctx context.Context, id int64) error {
+	query := `
+		UPDATE api_keys
+		SET last_used_at = $1
+		WHERE id = $2`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now().UTC().Truncate(time.Second), id)
+	return contextError(ctx, err)
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var scopes string
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.CreatedAt, &key.UserID, &key.Name, &scopes, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Split(scopes, ",")
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return &key, nil
+}
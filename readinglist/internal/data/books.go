@@ -1,148 +1,424 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/lib/pq"
+	"readinglist.github.io/internal/validator"
 )
 
 type Book struct {
-	ID        int64     `json:"id"` //change name to lower case
-	CreatedAt time.Time `json:"-"`  //hide the field in json marshalling
-	Title     string    `json:"title"`
-	Published int       `json:"published,omitempty"`
-	Pages     int       `json:"pages,omitempty,string"` // change return data type to string
-	Genres    []string  `json:"genres,omitempty"`       //string slice
-	Rating    float32   `json:"rating,omitempty"`
-	Version   int32     `json:"-"`
+	ID        int64      `json:"id"` //change name to lower case
+	CreatedAt time.Time  `json:"-"`  //hide the field in json marshalling
+	Title     string     `json:"title"`
+	Published int        `json:"published,omitempty"`
+	Pages     int        `json:"pages,omitempty,string"` // change return data type to string
+	Genres    []string   `json:"genres,omitempty"`       //string slice
+	Rating    float32    `json:"rating,omitempty"`
+	Version   int32      `json:"-"`
+	UserID    int64      `json:"-"`                    //owner, every query is scoped to it
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` //set while the book is in the trash
 }
 
+// ValidateBook checks a book before it is created or updated
+func ValidateBook(v *validator.Validator, book *Book) {
+	v.Check(book.Title != "", "title", "must be provided")
+	v.Check(len(book.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	v.Check(book.Published >= 0, "published", "must not be negative")
+	v.Check(book.Published <= time.Now().Year(), "published", "must not be in the future")
+
+	v.Check(book.Pages >= 0, "pages", "must not be negative")
+
+	v.Check(len(book.Genres) <= 10, "genres", "must not contain more than 10 genres")
+	v.Check(validator.Unique(book.Genres), "genres", "must not contain duplicate values")
+	for _, genre := range book.Genres {
+		v.Check(genre != "", "genres", "must not contain empty values")
+	}
+
+	v.Check(book.Rating >= 0 && book.Rating <= 5, "rating", "must be between 0 and 5")
+}
+
+// BookModel is the SQL BookStore, the same queries run on PostgreSQL and SQLite and the
+// dialect holds the little that differs between them
 type BookModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Timeout time.Duration //upper limit on how long any single query may run
+	dialect bookDialect
+}
+
+// bookDialect is how one database stores genres and filters books by them
+type bookDialect struct {
+	genres     func(genres []string) any  //the genres as a query argument
+	scanGenres func(genres *[]string) any //the Scan destination for the genres column
+	filters    string                     //the GetAll conditions on the title ($1) and genres ($2)
 }
 
-func (b BookModel) Insert(book *Book) error {
+// postgresBooks keeps genres in a text[] column
+var postgresBooks = bookDialect{
+	genres:     func(genres []string) any { return pq.Array(genres) },
+	scanGenres: func(genres *[]string) any { return pq.Array(genres) },
+	filters: `
+		AND (title ILIKE '%' || $1 || '%' OR $1 = '')
+		AND (genres @> $2 OR $2 = '{}')`,
+}
+
+// NewBookModel is the BookStore for PostgreSQL
+func NewBookModel(db *sql.DB, timeout time.Duration) BookModel {
+	return BookModel{DB: db, Timeout: timeout, dialect: postgresBooks}
+}
+
+// Insert saves a new book and its first revision
+func (b BookModel) Insert(ctx context.Context, book *Book, actor Actor) error {
 	query := `
-		INSERT INTO books (title, published, pages, genres, rating)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO books (title, published, pages, genres, rating, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id, created_at, version`
 
-	args := []interface{}{book.Title, book.Published, book.Pages, pq.Array(book.Genres), book.Rating} //used to populate arguments in query above
-	// return the auto generated system values to Go object
-	return b.DB.QueryRow(query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
+	if book.Genres == nil {
+		book.Genres = []string{} //nil would be sent as NULL and genres is NOT NULL
+	}
+
+	ctx, cancel := withTimeout(ctx, b.Timeout)
+	defer cancel()
+
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback() //no-op once committed
+
+	args := []interface{}{book.Title, book.Published, book.Pages, b.dialect.genres(book.Genres), book.Rating, book.UserID}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	if err := b.revisions().insert(ctx, tx, book.UserID, newRevision(book, RevisionCreate, actor)); err != nil {
+		return err
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+// InsertMany saves the books and their first revisions in one transaction, either all of them are
+// saved or none are. Each statement gets the usual timeout rather than the whole batch sharing one.
+// COPY would be quicker on PostgreSQL but can't give us back the ids
+func (b BookModel) InsertMany(ctx context.Context, books []*Book, actor Actor) error {
+	query := `
+		INSERT INTO books (title, published, pages, genres, rating, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, version`
+
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer stmt.Close()
+
+	for _, book := range books {
+		if book.Genres == nil {
+			book.Genres = []string{}
+		}
+
+		if err := b.insertWith(ctx, tx, stmt, book, actor); err != nil {
+			return err
+		}
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+// insertWith runs the prepared insert for one book of a batch along with its revision
+func (b BookModel) insertWith(ctx context.Context, tx *sql.Tx, stmt *sql.Stmt, book *Book, actor Actor) error {
+	ctx, cancel := withTimeout(ctx, b.Timeout)
+	defer cancel()
+
+	args := []interface{}{book.Title, book.Published, book.Pages, b.dialect.genres(book.Genres), book.Rating, book.UserID}
+	err := stmt.QueryRowContext(ctx, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return b.revisions().insert(ctx, tx, book.UserID, newRevision(book, RevisionCreate, actor))
 }
 
-func (b BookModel) Get(id int64) (*Book, error) {
+func (b BookModel) Get(ctx context.Context, userID, id int64) (*Book, error) {
 	if id < 1 {
-		return nil, errors.New("record not found")
+		return nil, ErrRecordNotFound
 	}
 
 	query := `
-		SELECT id, created_at, title, published, pages, genres, rating
+		SELECT ` + bookColumns + `
 		FROM books
-		WHERE id = $1`
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
 
-	var book Book //used to hold book record
+	var book Book
 
-	err := b.DB.QueryRow(query, id).Scan( //id is only arg
-		&book.ID,
-		&book.CreatedAt,
-		&book.Title,
-		&book.Published,
-		&book.Pages,
-		pq.Array(&book.Genres),
-		&book.Rating,
-	)
+	ctx, cancel := withTimeout(ctx, b.Timeout)
+	defer cancel()
 
+	err := b.scan(b.DB.QueryRowContext(ctx, query, id, userID), &book) //only the owner can see the book
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return nil, errors.New("record not found")
+			return nil, ErrRecordNotFound
 		default:
-			return nil, err
+			return nil, contextError(ctx, err)
 		}
 	}
 
 	return &book, nil
 }
 
-func (b BookModel) Update(book *Book) error {
+// Update saves every writable field of the book and records the new version in its history
+func (b BookModel) Update(ctx context.Context, book *Book, actor Actor) error {
 	query := `
 		UPDATE books
-		SET title = $1, published = $2, pages = $3, genres = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET title = $1, published = $2, pages = $3, genres = $4, rating = $5, version = version + 1
+		WHERE id = $6 AND version = $7 AND user_id = $8 AND deleted_at IS NULL
 		RETURNING version`
 
-	args := []interface{}{book.Title, book.Published, book.Pages, pq.Array(book.Genres), book.ID, book.Version}
-	return b.DB.QueryRow(query, args...).Scan(&book.Version)
-}
+	if book.Genres == nil {
+		book.Genres = []string{}
+	}
 
-func (b BookModel) Delete(id int64) error {
-	if id < 1 {
-		return errors.New("record not found")
+	ctx, cancel := withTimeout(ctx, b.Timeout)
+	defer cancel()
+
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
 	}
+	defer tx.Rollback()
 
-	query := `
-		DELETE FROM books
-		WHERE id = $1`
+	args := []interface{}{book.Title, book.Published, book.Pages, b.dialect.genres(book.Genres), book.Rating, book.ID, book.Version, book.UserID}
 
-	results, err := b.DB.Exec(query, id)
+	//no row back means the version changed (or the book was moved to the trash) since it was read
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&book.Version)
 	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	if err := b.revisions().insert(ctx, tx, book.UserID, newRevision(book, RevisionUpdate, actor)); err != nil {
 		return err
 	}
 
-	rowsAffected, err := results.RowsAffected()
+	return contextError(ctx, tx.Commit())
+}
+
+// Delete moves the book to the trash
+func (b BookModel) Delete(ctx context.Context, userID, id int64, actor Actor) error {
+	query := `
+		UPDATE books
+		SET deleted_at = $3, version = version + 1
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		RETURNING ` + bookColumns
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	books, err := b.revisions().changeBooks(ctx, query, []any{id, userID, now}, b.scan, RevisionDelete, actor, false)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return errors.New("record not found")
+	if len(books) == 0 {
+		return ErrRecordNotFound
 	}
 
 	return nil
 }
 
-func (b BookModel) GetAll() ([]*Book, error) {
+// Restore takes one of the user's books back out of the trash
+func (b BookModel) Restore(ctx context.Context, userID, id int64, actor Actor) (*Book, error) {
 	query := `
-	  SELECT * 
-	  FROM books
-	  ORDER BY id`
+		UPDATE books
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+		RETURNING ` + bookColumns
 
-	rows, err := b.DB.Query(query)
+	books, err := b.revisions().changeBooks(ctx, query, []any{id, userID}, b.scan, RevisionRestore, actor, false)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(books) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return books[0], nil
+}
+
+// Purge removes a book in the trash for good whoever owns it, its history is kept with a final purge revision
+func (b BookModel) Purge(ctx context.Context, id int64, actor Actor) error {
+	query := `
+		DELETE FROM books
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING ` + bookColumns
+
+	books, err := b.revisions().changeBooks(ctx, query, []any{id}, b.scan, RevisionPurge, actor, true)
+	if err != nil {
+		return err
+	}
+
+	if len(books) == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PurgeTrash purges every book that went into the trash before deletedBefore and says how many there were
+func (b BookModel) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	query := `
+		DELETE FROM books
+		WHERE deleted_at < $1
+		RETURNING ` + bookColumns
+
+	books, err := b.revisions().changeBooks(ctx, query, []any{deletedBefore.UTC()}, b.scan, RevisionPurge, Actor{}, true)
+	return len(books), err
+}
+
+// History lists the revisions of one of the user's books, trashed and purged books included
+func (b BookModel) History(ctx context.Context, userID, id int64) ([]*BookRevision, error) {
+	return b.revisions().history(ctx, userID, id)
+}
+
+// GetVersion returns the book as it was at an earlier version
+func (b BookModel) GetVersion(ctx context.Context, userID, id int64, version int32) (*Book, error) {
+	return b.revisions().version(ctx, userID, id, version)
+}
+
+func (b BookModel) revisions() sqlRevisions {
+	return sqlRevisions{DB: b.DB, Timeout: b.Timeout}
+}
+
+// countPastLastPage counts the books matching the filters when the page asked for is past the
+// last one, there are no rows to carry count(*) OVER() so the first page is fetched for it instead
+func countPastLastPage(ctx context.Context, books BookStore, userID int64, filters Filters) (int, error) {
+	filters.Page, filters.PageSize = 1, 1
+	_, metadata, err := books.GetAll(ctx, userID, filters)
+	return metadata.TotalRecords, err
+}
+
+// GetAll returns one page of books matching the filters along with the paging metadata
+func (b BookModel) GetAll(ctx context.Context, userID int64, filters Filters) ([]*Book, Metadata, error) {
+	//count(*) OVER() gives us the total matching rows before LIMIT/OFFSET is applied
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), `+bookColumns+`
+		FROM books
+		WHERE user_id = $8
+		AND (deleted_at IS NOT NULL) = $9 %s
+		AND rating >= $3
+		AND (published >= $4 OR $4 = 0)
+		AND (published <= $5 OR $5 = 0)
+		ORDER BY %s
+		LIMIT $6 OFFSET $7`, b.dialect.filters, filters.orderBy())
+
+	genres := filters.Genres
+	if genres == nil {
+		genres = []string{} //a nil slice is sent as NULL which would never match '{}'
+	}
+
+	args := []interface{}{
+		filters.Title,
+		b.dialect.genres(genres),
+		filters.MinRating,
+		filters.PublishedFrom,
+		filters.PublishedTo,
+		filters.limit(),
+		filters.offset(),
+		userID,
+		filters.Trashed,
+	}
+
+	ctx, cancel := withTimeout(ctx, b.Timeout)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
 	defer rows.Close()
 
+	totalRecords := 0
 	books := []*Book{} //slice of Books
 
 	for rows.Next() {
 		var book Book
 
-		err := rows.Scan(
-			&book.ID,
-			&book.CreatedAt,
-			&book.Title,
-			&book.Published,
-			&book.Pages,
-			pq.Array(&book.Genres),
-			&book.Version,
-			&book.Rating,
-		)
-		if err != nil {
-			return nil, err
+		if err := b.scan(countedRow{rows, &totalRecords}, &book); err != nil {
+			return nil, Metadata{}, err
 		}
 
 		books = append(books, &book)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	if len(books) == 0 && filters.Page > 1 {
+		rows.Close() //done with them, the count shouldn't need a second connection
+		if totalRecords, err = countPastLastPage(ctx, b, userID, filters); err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return books, metadata, nil
+}
+
+// scan reads the bookColumns of one row
+func (b BookModel) scan(row rowScanner, book *Book) error {
+	var deletedAt sql.NullTime
+
+	err := row.Scan(
+		&book.ID,
+		&book.CreatedAt,
+		&book.Title,
+		&book.Published,
+		&book.Pages,
+		b.dialect.scanGenres(&book.Genres),
+		&book.Rating,
+		&book.Version,
+		&book.UserID,
+		&deletedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if deletedAt.Valid {
+		book.DeletedAt = &deletedAt.Time
 	}
 
-	return books, nil
+	return nil
+}
+
+// countedRow reads the count(*) OVER() column GetAll puts in front of the bookColumns
+type countedRow struct {
+	rowScanner
+	total *int
+}
+
+func (r countedRow) Scan(dest ...any) error {
+	return r.rowScanner.Scan(append([]any{r.total}, dest...)...)
 }
@@ -0,0 +1,303 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryBookModel is a BookStore that lives in a map, safe for concurrent use
+type MemoryBookModel struct {
+	mu        sync.RWMutex
+	books     map[int64]*Book
+	revisions map[int64][]*BookRevision //by book id, oldest first
+	nextID    int64
+	nextRevID int64
+}
+
+func NewMemoryBookModel() *MemoryBookModel {
+	return &MemoryBookModel{
+		books:     make(map[int64]*Book),
+		revisions: make(map[int64][]*BookRevision),
+		nextID:    1,
+		nextRevID: 1,
+	}
+}
+
+// copyBook stops callers from changing stored books through the pointers we hand out
+func copyBook(book *Book) *Book {
+	c := *book
+	c.Genres = slices.Clone(book.Genres)
+	return &c
+}
+
+func (m *MemoryBookModel) Insert(ctx context.Context, book *Book, actor Actor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	book.ID = m.nextID
+	book.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	book.Version = 1
+	m.nextID++
+
+	m.books[book.ID] = copyBook(book)
+	m.record(book, RevisionCreate, actor)
+
+	return nil
+}
+
+// InsertMany is Insert for a batch, they all go in under the one lock
+func (m *MemoryBookModel) InsertMany(ctx context.Context, books []*Book, actor Actor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, book := range books {
+		book.ID = m.nextID
+		book.CreatedAt = now
+		book.Version = 1
+		m.nextID++
+
+		m.books[book.ID] = copyBook(book)
+		m.record(book, RevisionCreate, actor)
+	}
+
+	return nil
+}
+
+// record adds a revision for the book as it is now, the caller holds the write lock
+func (m *MemoryBookModel) record(book *Book, action string, actor Actor) {
+	rev := newRevision(book, action, actor)
+	rev.ID = m.nextRevID
+	m.nextRevID++
+
+	m.revisions[book.ID] = append(m.revisions[book.ID], rev)
+}
+
+func (m *MemoryBookModel) Get(ctx context.Context, userID, id int64) (*Book, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	book, ok := m.books[id]
+	if !ok || book.UserID != userID || book.DeletedAt != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return copyBook(book), nil
+}
+
+func (m *MemoryBookModel) Update(ctx context.Context, book *Book, actor Actor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.books[book.ID]
+	if !ok || stored.Version != book.Version || stored.UserID != book.UserID || stored.DeletedAt != nil {
+		return ErrEditConflict
+	}
+
+	book.Version++
+	m.books[book.ID] = copyBook(book)
+	m.record(book, RevisionUpdate, actor)
+
+	return nil
+}
+
+func (m *MemoryBookModel) Delete(ctx context.Context, userID, id int64, actor Actor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	book, ok := m.books[id]
+	if !ok || book.UserID != userID || book.DeletedAt != nil {
+		return ErrRecordNotFound
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	book.DeletedAt = &now
+	book.Version++
+	m.record(book, RevisionDelete, actor)
+
+	return nil
+}
+
+func (m *MemoryBookModel) Restore(ctx context.Context, userID, id int64, actor Actor) (*Book, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	book, ok := m.books[id]
+	if !ok || book.UserID != userID || book.DeletedAt == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	book.DeletedAt = nil
+	book.Version++
+	m.record(book, RevisionRestore, actor)
+
+	return copyBook(book), nil
+}
+
+func (m *MemoryBookModel) Purge(ctx context.Context, id int64, actor Actor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	book, ok := m.books[id]
+	if !ok || book.DeletedAt == nil {
+		return ErrRecordNotFound
+	}
+
+	m.purge(book, actor)
+
+	return nil
+}
+
+func (m *MemoryBookModel) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for _, book := range m.books {
+		if book.DeletedAt != nil && book.DeletedAt.Before(deletedBefore) {
+			m.purge(book, Actor{})
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// purge drops the book, the caller holds the write lock
+func (m *MemoryBookModel) purge(book *Book, actor Actor) {
+	delete(m.books, book.ID)
+
+	book.Version++ //the purge is a change of its own
+	m.record(book, RevisionPurge, actor)
+}
+
+func (m *MemoryBookModel) History(ctx context.Context, userID, id int64) ([]*BookRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revisions := []*BookRevision{}
+	for _, rev := range m.revisions[id] {
+		if rev.Book.UserID == userID {
+			revisions = append(revisions, copyRevision(rev))
+		}
+	}
+
+	if len(revisions) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return revisions, nil
+}
+
+func (m *MemoryBookModel) GetVersion(ctx context.Context, userID, id int64, version int32) (*Book, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, rev := range m.revisions[id] {
+		if rev.Book.UserID == userID && rev.Version == version && rev.Action != RevisionPurge {
+			return copyRevision(rev).Book, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// copyRevision is copyBook for revisions, the SQL backends don't hand out the owner or created_at either
+func copyRevision(rev *BookRevision) *BookRevision {
+	r := *rev
+	r.Book = copyBook(rev.Book)
+	r.Book.UserID = 0
+	r.Book.CreatedAt = time.Time{}
+	r.Book.DeletedAt = nil
+	return &r
+}
+
+func (m *MemoryBookModel) GetAll(ctx context.Context, userID int64, filters Filters) ([]*Book, Metadata, error) {
+	m.mu.RLock()
+	matches := []*Book{}
+	for _, book := range m.books {
+		if book.UserID == userID && filters.matches(book) {
+			matches = append(matches, copyBook(book))
+		}
+	}
+	m.mu.RUnlock()
+
+	slices.SortFunc(matches, filters.compare)
+
+	metadata := calculateMetadata(len(matches), filters.Page, filters.PageSize)
+
+	start := min(filters.offset(), len(matches))
+	end := min(start+filters.limit(), len(matches))
+
+	return matches[start:end], metadata, nil
+}
+
+// matches applies the same filters as the SQL WHERE clauses
+func (f Filters) matches(book *Book) bool {
+	if f.Title != "" && !strings.Contains(strings.ToLower(book.Title), strings.ToLower(f.Title)) {
+		return false
+	}
+
+	for _, genre := range f.Genres {
+		if !slices.Contains(book.Genres, genre) {
+			return false
+		}
+	}
+
+	if float64(book.Rating) < f.MinRating {
+		return false
+	}
+
+	if f.PublishedFrom != 0 && book.Published < f.PublishedFrom {
+		return false
+	}
+
+	if f.PublishedTo != 0 && book.Published > f.PublishedTo {
+		return false
+	}
+
+	if f.Trashed != (book.DeletedAt != nil) {
+		return false
+	}
+
+	return true
+}
+
+// compare orders two books the same way orderBy does in SQL
+func (f Filters) compare(a, b *Book) int {
+	for _, s := range f.Sort {
+		if !f.sortAllowed(s) {
+			panic("unsafe sort parameter: " + s)
+		}
+
+		direction := 1
+		if strings.HasPrefix(s, "-") {
+			direction = -1
+		}
+
+		var c int
+		switch strings.TrimPrefix(s, "-") {
+		case "title":
+			c = cmp.Compare(a.Title, b.Title)
+		case "published":
+			c = cmp.Compare(a.Published, b.Published)
+		case "pages":
+			c = cmp.Compare(a.Pages, b.Pages)
+		case "rating":
+			c = cmp.Compare(a.Rating, b.Rating)
+		case "id":
+			c = cmp.Compare(a.ID, b.ID)
+		}
+
+		if c != 0 {
+			return c * direction
+		}
+	}
+
+	return cmp.Compare(a.ID, b.ID) //id ASC breaks any tie, as in orderBy
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// sqliteGenres stores genres as a JSON array in a TEXT column, SQLite has no array type
+type sqliteGenres []string
+
+func (g sqliteGenres) Value() (driver.Value, error) {
+	if g == nil {
+		return "[]", nil
+	}
+
+	js, err := json.Marshal([]string(g))
+	return string(js), err
+}
+
+func (g *sqliteGenres) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), g)
+	case []byte:
+		return json.Unmarshal(v, g)
+	case nil:
+		*g = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into genres", src)
+	}
+}
+
+// sqliteBooks keeps genres as JSON in a TEXT column. LIKE is already case-insensitive in SQLite,
+// the genres check reads as "there is no requested genre that the book doesn't have"
+var sqliteBooks = bookDialect{
+	genres:     func(genres []string) any { return sqliteGenres(genres) },
+	scanGenres: func(genres *[]string) any { return (*sqliteGenres)(genres) },
+	filters: `
+		AND (title LIKE '%' || $1 || '%' OR $1 = '')
+		AND NOT EXISTS (
+			SELECT 1 FROM json_each($2) AS wanted
+			WHERE wanted.value NOT IN (SELECT value FROM json_each(books.genres))
+		)`,
+}
+
+// NewSQLiteBookModel is the BookStore for an embedded SQLite database, used for local development without Postgres
+func NewSQLiteBookModel(db *sql.DB, timeout time.Duration) BookModel {
+	return BookModel{DB: db, Timeout: timeout, dialect: sqliteBooks}
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"readinglist.github.io/internal/validator"
+)
+
+// Filters holds the query string options for listing books
+type Filters struct {
+	Title         string
+	Genres        []string
+	MinRating     float64
+	PublishedFrom int
+	PublishedTo   int
+	Page          int
+	PageSize      int
+	Sort          []string //e.g. ["-rating", "title"], a leading "-" means descending
+	SortSafelist  []string //the only sort values we will ever put into ORDER BY
+	Trashed       bool     //list the books in the trash instead of the live ones
+}
+
+// Metadata is returned alongside a page of results
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records"`
+}
+
+// ValidateFilters makes sure the paging and sorting values are sane before they reach the database
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.Check(f.Page > 0, "page", "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+
+	v.Check(f.MinRating >= 0, "min_rating", "must not be negative")
+
+	if f.PublishedFrom != 0 && f.PublishedTo != 0 {
+		v.Check(f.PublishedFrom <= f.PublishedTo, "published_from", "must not be after published_to")
+	}
+
+	for _, s := range f.Sort {
+		v.Check(f.sortAllowed(s), "sort", "invalid sort value")
+	}
+}
+
+func (f Filters) sortAllowed(value string) bool {
+	return validator.PermittedValue(value, f.SortSafelist...)
+}
+
+// orderBy builds the ORDER BY clause. Only values from the safelist are used so
+// the user can never inject SQL. The keys keep the order the client gave them, and
+// id ASC is added last when id isn't one of them so paging is stable
+func (f Filters) orderBy() string {
+	clauses := make([]string, 0, len(f.Sort)+1)
+	sortedByID := false
+
+	for _, s := range f.Sort {
+		if !f.sortAllowed(s) {
+			panic("unsafe sort parameter: " + s)
+		}
+
+		column := strings.TrimPrefix(s, "-")
+		direction := "ASC"
+		if strings.HasPrefix(s, "-") {
+			direction = "DESC"
+		}
+
+		sortedByID = sortedByID || column == "id"
+		clauses = append(clauses, fmt.Sprintf("%s %s", column, direction))
+	}
+
+	if !sortedByID {
+		clauses = append(clauses, "id ASC")
+	}
+
+	return strings.Join(clauses, ", ")
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// calculateMetadata works out the paging info from the total record count
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
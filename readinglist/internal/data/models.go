@@ -1,13 +1,141 @@
 package data
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrRecordNotFound is returned when looking up a record that doesn't exist
+	ErrRecordNotFound = errors.New("record not found")
+	// ErrEditConflict is returned when an update is made against an out of date version of a record
+	ErrEditConflict = errors.New("edit conflict")
+)
+
+// BookStore is implemented by every storage backend for books. Books belong to a user and
+// every method only sees that user's rows, someone else's book looks the same as a missing one.
+// Every change is recorded as a BookRevision crediting the actor.
+//
+// Delete only moves a book to the trash, Get, Update and GetAll act as if it wasn't there
+// (GetAll lists the trash instead with Filters.Trashed) until it is restored or purged
+type BookStore interface {
+	Insert(ctx context.Context, book *Book, actor Actor) error
+	InsertMany(ctx context.Context, books []*Book, actor Actor) error
+	Get(ctx context.Context, userID, id int64) (*Book, error)
+	Update(ctx context.Context, book *Book, actor Actor) error
+	Delete(ctx context.Context, userID, id int64, actor Actor) error
+	Restore(ctx context.Context, userID, id int64, actor Actor) (*Book, error)
+	Purge(ctx context.Context, id int64, actor Actor) error
+	PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error)
+	GetAll(ctx context.Context, userID int64, filters Filters) ([]*Book, Metadata, error)
+	History(ctx context.Context, userID, id int64) ([]*BookRevision, error)
+	GetVersion(ctx context.Context, userID, id int64, version int32) (*Book, error)
+}
+
+// UserStore is implemented by every storage backend for users
+type UserStore interface {
+	Insert(ctx context.Context, user *User, permissions ...string) error //grants the permissions along with it
+	Get(ctx context.Context, id int64) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error)
+}
+
+// TokenStore is implemented by every storage backend for tokens
+type TokenStore interface {
+	New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+	DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+}
+
+// PermissionStore is implemented by every storage backend for user permissions
+type PermissionStore interface {
+	GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+	AddForUser(ctx context.Context, userID int64, codes ...string) error
+	RemoveForUser(ctx context.Context, userID int64, codes ...string) error
+}
+
+// APIKeyStore is implemented by every storage backend for API keys
+type APIKeyStore interface {
+	New(ctx context.Context, userID int64, name string, scopes []string) (*APIKey, error)
+	GetByKey(ctx context.Context, plaintext string) (*APIKey, error)
+	GetAllForUser(ctx context.Context, userID int64) ([]*APIKey, error)
+	Revoke(ctx context.Context, userID, id int64) error
+	Touch(ctx context.Context, id int64) error
+}
 
 type Models struct {
-	Books BookModel
+	Books       BookStore
+	Users       UserStore
+	Tokens      TokenStore
+	Permissions PermissionStore
+	APIKeys     APIKeyStore
+}
+
+// NewModels wires up the PostgreSQL models, queryTimeout limits how long each database call may take
+func NewModels(db *sql.DB, queryTimeout time.Duration) Models {
+	return Models{
+		Books:       NewBookModel(db, queryTimeout),
+		Users:       UserModel{DB: db, Timeout: queryTimeout},
+		Tokens:      TokenModel{DB: db, Timeout: queryTimeout},
+		Permissions: PermissionModel{DB: db, Timeout: queryTimeout},
+		APIKeys:     APIKeyModel{DB: db, Timeout: queryTimeout},
+	}
 }
 
-func NewModels(db *sql.DB) Models {
+// NewSQLiteModels wires up the models for an embedded SQLite database
+func NewSQLiteModels(db *sql.DB, queryTimeout time.Duration) Models {
 	return Models{
-		Books: BookModel{DB: db},
+		Books:       NewSQLiteBookModel(db, queryTimeout),
+		Users:       UserModel{DB: db, Timeout: queryTimeout},
+		Tokens:      TokenModel{DB: db, Timeout: queryTimeout},
+		Permissions: PermissionModel{DB: db, Timeout: queryTimeout},
+		APIKeys:     APIKeyModel{DB: db, Timeout: queryTimeout},
+	}
+}
+
+// NewMemoryModels keeps everything in memory, nothing survives a restart. Handy for tests and demos
+func NewMemoryModels() Models {
+	accounts := newMemoryAccounts()
+
+	return Models{
+		Books:       NewMemoryBookModel(),
+		Users:       MemoryUserModel{accounts},
+		Tokens:      MemoryTokenModel{accounts},
+		Permissions: MemoryPermissionModel{accounts},
+		APIKeys:     MemoryAPIKeyModel{accounts},
+	}
+}
+
+// withTimeout caps the caller's context with a model's query timeout, zero means no extra limit
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// contextError makes sure a query that failed because its context ended reports the context's
+// error, the driver's own message (e.g. "canceling statement due to user request") is kept for the logs
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %v", ctxErr, err)
+	}
+	return err
+}
+
+// isUniqueViolation spots a unique constraint error from either the Postgres or the SQLite driver
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
 	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
 }
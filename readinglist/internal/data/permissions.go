@@ -0,0 +1,110 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+)
+
+// Permission codes, anything else is rejected before it reaches the database
+const (
+	PermissionBooksRead  = "books:read"
+	PermissionBooksWrite = "books:write"
+	PermissionAdmin      = "admin"
+)
+
+// PermissionCodes lists every code that can be granted
+var PermissionCodes = []string{PermissionBooksRead, PermissionBooksWrite, PermissionAdmin}
+
+// DefaultPermissions are granted to every newly registered user
+var DefaultPermissions = []string{PermissionBooksRead, PermissionBooksWrite}
+
+// Permissions holds the codes granted to a user
+type Permissions []string
+
+// Include reports whether code has been granted
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+// PermissionModel is the SQL PermissionStore, the queries work on both PostgreSQL and SQLite
+type PermissionModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	query := `
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+		WHERE users_permissions.user_id = $1
+		ORDER BY permissions.code`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, code)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return permissions, nil
+}
+
+// addPermissionQuery grants one code, UserModel.Insert uses it too
+const addPermissionQuery = `
+	INSERT INTO users_permissions (user_id, permission_id)
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = $2
+	ON CONFLICT DO NOTHING`
+
+// AddForUser grants the codes, codes the user already has are ignored
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	return m.eachCode(ctx, addPermissionQuery, userID, codes)
+}
+
+// RemoveForUser revokes the codes, codes the user doesn't have are ignored
+func (m PermissionModel) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `
+		DELETE FROM users_permissions
+		WHERE user_id = $1
+		AND permission_id IN (SELECT id FROM permissions WHERE code = $2)`
+
+	return m.eachCode(ctx, query, userID, codes)
+}
+
+// eachCode runs query once per code in a single transaction so a change is all or nothing
+func (m PermissionModel) eachCode(ctx context.Context, query string, userID int64, codes []string) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	for _, code := range codes {
+		if _, err := tx.ExecContext(ctx, query, userID, code); err != nil {
+			return contextError(ctx, err)
+		}
+	}
+
+	return contextError(ctx, tx.Commit())
+}
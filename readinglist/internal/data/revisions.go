@@ -0,0 +1,250 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// What happened to a book in a revision. Baseline revisions were made by the migration that
+// started recording history, for books that already existed
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionDelete   = "delete" //moved to the trash
+	RevisionRestore  = "restore"
+	RevisionPurge    = "purge" //removed from the trash for good
+	RevisionBaseline = "baseline"
+)
+
+// Actor is whoever made a change, APIKeyID is set when they did it through an API key
+type Actor struct {
+	UserID   int64
+	APIKeyID int64
+}
+
+// BookRevision is a book as it was after one change, or just before it was purged
+type BookRevision struct {
+	ID        int64     `json:"id"`
+	BookID    int64     `json:"book_id"`
+	Version   int32     `json:"version"`
+	Action    string    `json:"action"`
+	ActorID   *int64    `json:"actor_id"` //nil for baseline revisions and actors who have since been removed
+	APIKeyID  *int64    `json:"api_key_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Book      *Book     `json:"book"`
+}
+
+// bookSnapshot is what's stored for each revision, the writable fields of the book
+type bookSnapshot struct {
+	Title     string   `json:"title"`
+	Published int      `json:"published"`
+	Pages     int      `json:"pages"`
+	Genres    []string `json:"genres"`
+	Rating    float32  `json:"rating"`
+}
+
+// newRevision records book, as it is now, against actor
+func newRevision(book *Book, action string, actor Actor) *BookRevision {
+	rev := &BookRevision{
+		BookID:    book.ID,
+		Version:   book.Version,
+		Action:    action,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Book:      copyBook(book),
+	}
+
+	if actor.UserID != 0 {
+		rev.ActorID = &actor.UserID
+	}
+	if actor.APIKeyID != 0 {
+		rev.APIKeyID = &actor.APIKeyID
+	}
+
+	return rev
+}
+
+// sqlRevisions are the revision queries BookModel runs on both PostgreSQL and SQLite,
+// the snapshot column is jsonb in one and TEXT in the other but both take and give back JSON text
+type sqlRevisions struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// bookColumns is the column list BookModel.scan expects
+const bookColumns = "id, created_at, title, published, pages, genres, rating, version, user_id, deleted_at"
+
+// insert writes rev inside the transaction making the change, so a change is never missing from the history
+func (s sqlRevisions) insert(ctx context.Context, tx *sql.Tx, userID int64, rev *BookRevision) error {
+	query := `
+		INSERT INTO book_revisions (book_id, user_id, version, action, snapshot, actor_id, api_key_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	genres := rev.Book.Genres
+	if genres == nil {
+		genres = []string{}
+	}
+
+	snapshot, err := json.Marshal(bookSnapshot{
+		Title:     rev.Book.Title,
+		Published: rev.Book.Published,
+		Pages:     rev.Book.Pages,
+		Genres:    genres,
+		Rating:    rev.Book.Rating,
+	})
+	if err != nil {
+		return err
+	}
+
+	args := []interface{}{rev.BookID, userID, rev.Version, rev.Action, string(snapshot), rev.ActorID, rev.APIKeyID, rev.CreatedAt}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return contextError(ctx, err)
+}
+
+// history lists every revision of one of the user's books, oldest first
+func (s sqlRevisions) history(ctx context.Context, userID, id int64) ([]*BookRevision, error) {
+	query := `
+		SELECT id, book_id, version, action, snapshot, actor_id, api_key_id, created_at
+		FROM book_revisions
+		WHERE book_id = $1 AND user_id = $2
+		ORDER BY version`
+
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, id, userID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	revisions := []*BookRevision{}
+
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	if len(revisions) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return revisions, nil
+}
+
+// version finds the book as it was at one version, a purge revision doesn't count as a version of the book
+func (s sqlRevisions) version(ctx context.Context, userID, id int64, version int32) (*Book, error) {
+	query := `
+		SELECT id, book_id, version, action, snapshot, actor_id, api_key_id, created_at
+		FROM book_revisions
+		WHERE book_id = $1 AND user_id = $2 AND version = $3 AND action <> 'purge'`
+
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	rev, err := scanRevision(s.DB.QueryRowContext(ctx, query, id, userID, version))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return rev.Book, nil
+}
+
+func scanRevision(row rowScanner) (*BookRevision, error) {
+	var rev BookRevision
+	var snapshot []byte
+	var actorID, apiKeyID sql.NullInt64
+
+	err := row.Scan(&rev.ID, &rev.BookID, &rev.Version, &rev.Action, &snapshot, &actorID, &apiKeyID, &rev.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields bookSnapshot
+	if err := json.Unmarshal(snapshot, &fields); err != nil {
+		return nil, err
+	}
+
+	rev.Book = &Book{
+		ID:        rev.BookID,
+		Title:     fields.Title,
+		Published: fields.Published,
+		Pages:     fields.Pages,
+		Genres:    fields.Genres,
+		Rating:    fields.Rating,
+		Version:   rev.Version,
+	}
+
+	if actorID.Valid {
+		rev.ActorID = &actorID.Int64
+	}
+	if apiKeyID.Valid {
+		rev.APIKeyID = &apiKeyID.Int64
+	}
+
+	return &rev, nil
+}
+
+// changeBooks runs a statement that returns bookColumns for every row it changes, e.g. moving a book
+// to the trash, and records a revision for each of them in the same transaction. A hard delete passes
+// bump so the revision gets a version of its own, the row isn't there to bump
+func (s sqlRevisions) changeBooks(ctx context.Context, query string, args []any, scan func(rowScanner, *Book) error,
+	action string, actor Actor, bump bool) ([]*Book, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+		if err := scan(rows, &book); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		books = append(books, &book)
+	}
+
+	rows.Close() //the connection has to be free before the revisions can be written
+	if err := rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	for _, book := range books {
+		rev := newRevision(book, action, actor)
+		if bump {
+			rev.Version++
+		}
+
+		if err := s.insert(ctx, tx, book.UserID, rev); err != nil {
+			return nil, err
+		}
+	}
+
+	return books, contextError(ctx, tx.Commit())
+}
@@ -0,0 +1,248 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"readinglist.github.io/internal/validator"
+)
+
+// ErrDuplicateEmail is returned when registering an email address that is already taken
+var ErrDuplicateEmail = errors.New("duplicate email")
+
+// AnonymousUser is put in the request context when no credentials were sent
+var AnonymousUser = &User{}
+
+type User struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Password  password  `json:"-"`
+	Version   int       `json:"-"`
+}
+
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+// password keeps the plaintext (only while handling the request that set it) next to the bcrypt hash
+type password struct {
+	plaintext *string
+	hash      []byte
+}
+
+// Set hashes the plaintext password with bcrypt
+func (p *password) Set(plaintextPassword string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	if err != nil {
+		return err
+	}
+
+	p.plaintext = &plaintextPassword
+	p.hash = hash
+
+	return nil
+}
+
+// Matches checks a plaintext password against the stored hash
+func (p *password) Matches(plaintextPassword string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword), errors.Is(err, bcrypt.ErrHashTooShort): //too short covers accounts with no password, e.g. the legacy books owner
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// NormalizeEmail lower-cases an address so Alice@Example.com and alice@example.com are one account
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "must be provided")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+}
+
+func ValidatePasswordPlaintext(v *validator.Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
+	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long") //bcrypt ignores anything past 72 bytes
+}
+
+// ValidateUserDetails checks everything but the password, which may not be hashed yet
+func ValidateUserDetails(v *validator.Validator, user *User) {
+	v.Check(user.Name != "", "name", "must be provided")
+	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	ValidateEmail(v, user.Email)
+}
+
+func ValidateUser(v *validator.Validator, user *User) {
+	ValidateUserDetails(v, user)
+
+	if user.Password.plaintext != nil {
+		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+	}
+
+	//a missing hash is our bug, not something the client can fix
+	if user.Password.hash == nil {
+		panic("missing password hash for user")
+	}
+}
+
+// UserModel is the SQL UserStore, the queries work on both PostgreSQL and SQLite
+type UserModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Insert adds the user and grants it the permissions in one transaction, so there is never an
+// account without the permissions it was meant to start with
+func (m UserModel) Insert(ctx context.Context, user *User, permissions ...string) error {
+	query := `
+		INSERT INTO users (name, email, password_hash)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	args := []interface{}{user.Name, user.Email, user.Password.hash}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateEmail
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	for _, code := range permissions {
+		if _, err := tx.ExecContext(ctx, addPermissionQuery, user.ID, code); err != nil {
+			return contextError(ctx, err)
+		}
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+func (m UserModel) Get(ctx context.Context, id int64) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, version
+		FROM users
+		WHERE id = $1`
+
+	var user User
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &user, nil
+}
+
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, version
+		FROM users
+		WHERE email = $1`
+
+	var user User
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &user, nil
+}
+
+// GetForToken finds the owner of an unexpired token with the given scope
+func (m UserModel) GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.version
+		FROM users
+		INNER JOIN tokens
+		ON users.id = tokens.user_id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3`
+
+	args := []interface{}{tokenHash[:], scope, time.Now().UTC()}
+
+	var user User
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,156 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"readinglist.github.io/internal/data"
+)
+
+// The formats Parse understands. csv and ndjson are our own columns, the others are the library
+// exports other sites hand out, read as they come
+const (
+	FormatCSV        = "csv"
+	FormatNDJSON     = "ndjson"
+	FormatGoodreads  = "goodreads"
+	FormatStoryGraph = "storygraph"
+)
+
+var Formats = []string{FormatCSV, FormatNDJSON, FormatGoodreads, FormatStoryGraph}
+
+// Parse reads a file in one of the Formats
+func Parse(format string, r io.Reader) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return ParseCSV(r)
+	case FormatNDJSON:
+		return ParseNDJSON(r)
+	case FormatGoodreads:
+		return ParseGoodreads(r)
+	case FormatStoryGraph:
+		return ParseStoryGraph(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// maxGenres matches the limit ValidateBook puts on genres, a shelf too many shouldn't fail the whole book
+const maxGenres = 10
+
+// goodreadsStatusShelves say whether a book has been read, they aren't genres
+var goodreadsStatusShelves = []string{"read", "currently-reading", "to-read"}
+
+// goodreadsSeries matches the series Goodreads puts after a title, e.g. "Dune (Dune, #1)"
+var goodreadsSeries = regexp.MustCompile(`\s*\([^()]*#\d+(\.\d+)?\)$`)
+
+// ParseGoodreads reads goodreads_library_export.csv, from My Books > Import and export on Goodreads.
+// The year is the original publication year where there is one, rather than the year of the edition,
+// and the shelves other than read, currently-reading and to-read become genres. A rating of 0 means
+// the book wasn't rated
+func ParseGoodreads(r io.Reader) ([]Row, error) {
+	return readRecords(r, requireColumns("a Goodreads library export", "book id", "title", "my rating"), goodreadsRow)
+}
+
+func goodreadsRow(line int, field func(string) string) Row {
+	row := Row{Line: line, Book: &data.Book{Title: goodreadsSeries.ReplaceAllString(field("title"), "")}}
+	errs := make(map[string]string)
+
+	year := field("original publication year")
+	if year == "" {
+		year = field("year published")
+	}
+
+	if year != "" {
+		published, err := strconv.Atoi(year)
+		switch {
+		case err != nil:
+			errs["published"] = "must be an integer value"
+		case published > 0: //ancient works have negative years, we have no way to store those
+			row.Book.Published = published
+		}
+	}
+
+	if pages := field("number of pages"); pages != "" {
+		var err error
+		if row.Book.Pages, err = strconv.Atoi(pages); err != nil {
+			errs["pages"] = "must be an integer value"
+		}
+	}
+
+	exclusive := field("exclusive shelf")
+
+	genres := []string{}
+	for _, shelf := range splitList(field("bookshelves")) {
+		if strings.EqualFold(shelf, exclusive) || slices.Contains(goodreadsStatusShelves, strings.ToLower(shelf)) {
+			continue
+		}
+		genres = append(genres, shelf)
+	}
+	row.Book.Genres = limitGenres(genres)
+
+	if rating := field("my rating"); rating != "" {
+		stars, err := strconv.Atoi(rating)
+		if err != nil {
+			errs["rating"] = "must be an integer value"
+		}
+		row.Book.Rating = float32(stars)
+	}
+
+	if len(errs) > 0 {
+		row.Errors = errs
+	}
+
+	return row
+}
+
+// ParseStoryGraph reads the CSV from Manage Account > Export StoryGraph Library. It has no publication
+// year or page count, so those are left empty, the tags become genres and the star rating, which can
+// be in quarter stars, is kept as it is
+func ParseStoryGraph(r io.Reader) ([]Row, error) {
+	return readRecords(r, requireColumns("a StoryGraph export", "title", "read status", "star rating"), storyGraphRow)
+}
+
+func storyGraphRow(line int, field func(string) string) Row {
+	row := Row{Line: line, Book: &data.Book{Title: field("title"), Genres: limitGenres(splitList(field("tags")))}}
+
+	if rating := field("star rating"); rating != "" {
+		stars, err := strconv.ParseFloat(rating, 32)
+		if err != nil {
+			row.Errors = map[string]string{"rating": "must be a number"}
+		}
+		row.Book.Rating = float32(stars)
+	}
+
+	return row
+}
+
+// requireColumns checks an export has the columns we read, so the wrong file gets a clear error
+// rather than a report full of books with no title
+func requireColumns(what string, names ...string) func(map[string]int) error {
+	return func(columns map[string]int) error {
+		for _, name := range names {
+			if _, ok := columns[name]; !ok {
+				return fmt.Errorf("doesn't look like %s, it has no %q column", what, name)
+			}
+		}
+		return nil
+	}
+}
+
+// limitGenres drops repeated genres, ignoring case, and keeps the first maxGenres
+func limitGenres(genres []string) []string {
+	kept := []string{}
+	for _, genre := range genres {
+		if len(kept) == maxGenres {
+			break
+		}
+		if !slices.ContainsFunc(kept, func(k string) bool { return strings.EqualFold(k, genre) }) {
+			kept = append(kept, genre)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,273 @@
+package importer
+
+import (
+	"context"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"readinglist.github.io/internal/data"
+)
+
+func parseFixture(t *testing.T, parse func(io.Reader) ([]Row, error), name string) []Row {
+	t.Helper()
+
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := parse(f)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", name, err)
+	}
+
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			t.Fatalf("line %d: unexpected errors %v", row.Line, row.Errors)
+		}
+	}
+
+	return rows
+}
+
+func goodreadsFixture(t *testing.T) []Row {
+	return parseFixture(t, ParseGoodreads, "goodreads_library_export.csv")
+}
+
+func storyGraphFixture(t *testing.T) []Row {
+	return parseFixture(t, ParseStoryGraph, "storygraph_export.csv")
+}
+
+// bookAt finds the row on a line of the fixture, line 1 is the header
+func bookAt(t *testing.T, rows []Row, line int) *data.Book {
+	t.Helper()
+
+	for _, row := range rows {
+		if row.Line == line {
+			return row.Book
+		}
+	}
+
+	t.Fatalf("no row for line %d", line)
+	return nil
+}
+
+func TestParseGoodreads(t *testing.T) {
+	rows := goodreadsFixture(t)
+
+	if len(rows) != 6 {
+		t.Fatalf("got %d rows, want 6", len(rows))
+	}
+
+	tests := []struct {
+		name string
+		line int
+		want data.Book
+	}{
+		{
+			name: "series is dropped from the title",
+			line: 2,
+			want: data.Book{Title: "Dune", Published: 1965, Pages: 658, Genres: []string{"sci-fi", "classics", "favourites"}, Rating: 5},
+		},
+		{
+			name: "original publication year wins over the edition",
+			line: 3,
+			want: data.Book{Title: "The Catcher in the Rye", Published: 1951, Pages: 277, Genres: []string{"classics"}, Rating: 3},
+		},
+		{
+			name: "negative year and to-read shelf are dropped",
+			line: 4,
+			want: data.Book{Title: "The Odyssey", Published: 0, Pages: 541, Genres: []string{"classics", "poetry"}, Rating: 4},
+		},
+		{
+			name: "rating of 0 stays unrated and currently-reading isn't a genre",
+			line: 5,
+			want: data.Book{Title: "The Alchemist", Published: 1988, Pages: 182, Genres: []string{}, Rating: 0},
+		},
+		{
+			name: "edition year is used without an original and repeated shelves are merged",
+			line: 6,
+			want: data.Book{Title: "Gideon the Ninth", Published: 2019, Pages: 0, Genres: []string{"fantasy", "sci-fi", "queer"}, Rating: 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertBook(t, bookAt(t, rows, tt.line), tt.want)
+		})
+	}
+}
+
+func TestParseGoodreadsStatusShelves(t *testing.T) {
+	for _, row := range goodreadsFixture(t) {
+		for _, shelf := range []string{"read", "to-read", "currently-reading"} {
+			if slices.Contains(row.Book.Genres, shelf) {
+				t.Errorf("line %d: status shelf %q became a genre: %v", row.Line, shelf, row.Book.Genres)
+			}
+		}
+	}
+}
+
+// an exclusive shelf can be one the reader made, e.g. did-not-finish, it still isn't a genre
+func TestParseGoodreadsCustomExclusiveShelf(t *testing.T) {
+	export := "Book Id,Title,My Rating,Bookshelves,Exclusive Shelf\n" +
+		"1,Ulysses,0,\"did-not-finish, classics\",did-not-finish\n"
+
+	rows, err := ParseGoodreads(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rows[0].Book.Genres; !slices.Equal(got, []string{"classics"}) {
+		t.Errorf("genres: got %q, want [classics]", got)
+	}
+}
+
+func TestParseStoryGraph(t *testing.T) {
+	rows := storyGraphFixture(t)
+
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want 4", len(rows))
+	}
+
+	tests := []struct {
+		name string
+		line int
+		want data.Book
+	}{
+		{
+			name: "quarter stars are kept",
+			line: 2,
+			want: data.Book{Title: "Piranesi", Genres: []string{"fantasy", "favourites"}, Rating: 4.75},
+		},
+		{
+			name: "half stars are kept",
+			line: 3,
+			want: data.Book{Title: "Dune", Genres: []string{"sci-fi", "classics"}, Rating: 4.5},
+		},
+		{
+			name: "no rating stays unrated",
+			line: 5,
+			want: data.Book{Title: "Project Hail Mary", Genres: []string{}, Rating: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertBook(t, bookAt(t, rows, tt.line), tt.want)
+		})
+	}
+}
+
+func TestParseWrongExport(t *testing.T) {
+	f, err := os.Open("testdata/storygraph_export.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := ParseGoodreads(f); err == nil {
+		t.Error("a StoryGraph export was read as a Goodreads one")
+	}
+}
+
+// an export cut off or mangled on the way is a bad file, not a crash
+func TestParseMalformedExport(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(io.Reader) ([]Row, error)
+		body  string
+		want  string
+	}{
+		{
+			name:  "Goodreads unterminated quote",
+			parse: ParseGoodreads,
+			body:  "Book Id,Title,My Rating,Bookshelves\n1,Dune,5,\"sci-fi, classics\n2,Emma,4,\n",
+			want:  "has a malformed record on line 2",
+		},
+		{
+			name:  "Goodreads bare quote",
+			parse: ParseGoodreads,
+			body:  "Book Id,Title,My Rating\n1,Dune,5\n2,The \"Odyssey\",4\n",
+			want:  "has a malformed record on line 3",
+		},
+		{
+			name:  "StoryGraph unterminated quote",
+			parse: ParseStoryGraph,
+			body:  "Title,Read Status,Star Rating\n\"Piranesi,read,4.75\n",
+			want:  "has a malformed record on line 2",
+		},
+		{
+			name:  "StoryGraph cut off in the header",
+			parse: ParseStoryGraph,
+			body:  "Title,\"Read Status",
+			want:  "has a malformed record on line 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parse(strings.NewReader(tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportGoodreads(t *testing.T) {
+	books := data.NewMemoryBookModel()
+	ctx := context.Background()
+
+	report, err := Import(ctx, books, 1, data.Actor{UserID: 1}, goodreadsFixture(t), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Created != 5 || report.Skipped != 1 || report.Failed != 0 {
+		t.Fatalf("got created=%d skipped=%d failed=%d, want 5, 1 and 0", report.Created, report.Skipped, report.Failed)
+	}
+
+	dune := report.Rows[5]
+	if dune.Line != 7 || dune.Status != StatusSkipped || dune.Reason != "same book as line 2" {
+		t.Errorf("second Dune row: got %+v, want it skipped as the same book as line 2", dune)
+	}
+
+	//StoryGraph has no years, so its Dune is the one already imported
+	report, err = Import(ctx, books, 1, data.Actor{UserID: 1}, storyGraphFixture(t), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Created != 3 || report.Skipped != 1 {
+		t.Fatalf("got created=%d skipped=%d, want 3 and 1", report.Created, report.Skipped)
+	}
+
+	if dune := report.Rows[1]; dune.Status != StatusSkipped || dune.BookID != 1 {
+		t.Errorf("StoryGraph Dune: got %+v, want it skipped as book 1", dune)
+	}
+}
+
+func assertBook(t *testing.T, got *data.Book, want data.Book) {
+	t.Helper()
+
+	if got.Title != want.Title {
+		t.Errorf("title: got %q, want %q", got.Title, want.Title)
+	}
+	if got.Published != want.Published {
+		t.Errorf("published: got %d, want %d", got.Published, want.Published)
+	}
+	if got.Pages != want.Pages {
+		t.Errorf("pages: got %d, want %d", got.Pages, want.Pages)
+	}
+	if !slices.Equal(got.Genres, want.Genres) {
+		t.Errorf("genres: got %q, want %q", got.Genres, want.Genres)
+	}
+	if got.Rating != want.Rating {
+		t.Errorf("rating: got %v, want %v", got.Rating, want.Rating)
+	}
+}
@@ -0,0 +1,233 @@
+// Package importer adds many books to a reading list at once. The parsers turn a file into rows,
+// Import validates the rows with the same rules as creating a single book, skips the ones that
+// are already in the reading list and saves the rest
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"readinglist.github.io/internal/data"
+	"readinglist.github.io/internal/validator"
+)
+
+// MaxRows is the most rows one import may have, a bigger library has to be split up
+const MaxRows = 10_000
+
+// ErrTooManyRows is returned by the parsers when a file has more than MaxRows rows
+var ErrTooManyRows = fmt.Errorf("must not have more than %d rows", MaxRows)
+
+// batchSize is how many books a best effort import saves per transaction
+const batchSize = 100
+
+// What happened to each row
+const (
+	StatusCreated = "created"
+	StatusValid   = "valid" //would have been created, but it was a dry run or the import was rolled back
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// Row is one record of an import file. Errors holds any problem reading it, e.g. a year that
+// isn't a number, and Book is nil if it couldn't be read at all. Import does the validating
+type Row struct {
+	Line   int
+	Book   *data.Book
+	Errors map[string]string
+}
+
+type Options struct {
+	DryRun     bool //report what would happen without saving anything
+	BestEffort bool //save the good rows even when others failed, otherwise one failure saves nothing
+}
+
+// Result is the outcome for one row
+type Result struct {
+	Line   int               `json:"line"`
+	Status string            `json:"status"`
+	Title  string            `json:"title,omitempty"`
+	BookID int64             `json:"book_id,omitempty"`
+	Reason string            `json:"reason,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type Report struct {
+	DryRun     bool     `json:"dry_run"`
+	BestEffort bool     `json:"best_effort"`
+	Created    int      `json:"created"`
+	Skipped    int      `json:"skipped"`
+	Failed     int      `json:"failed"`
+	Rows       []Result `json:"rows"`
+}
+
+// RolledBack is true when nothing was saved because an all or nothing import had a failed row
+func (r *Report) RolledBack() bool {
+	return !r.BestEffort && r.Failed > 0
+}
+
+// Import adds the rows to the user's reading list. A row that is the same book as one already in
+// the list, or as an earlier row, is skipped rather than failed so a file can be imported again.
+// If saving a batch of a best effort import fails, the report is returned along with the error: the
+// books of earlier batches stay created and the rows of that batch and the ones after it are failed
+func Import(ctx context.Context, books data.BookStore, userID int64, actor data.Actor, rows []Row, opts Options) (*Report, error) {
+	existing, err := existingBooks(ctx, books, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{DryRun: opts.DryRun, BestEffort: opts.BestEffort, Rows: make([]Result, len(rows))}
+	seen := make(library) //the rows to save so far, by line
+
+	var valid []int //indexes of the rows to save
+
+	for i, row := range rows {
+		result := &report.Rows[i]
+		result.Line = row.Line
+
+		if row.Book == nil { //the record couldn't be read at all
+			result.Status, result.Errors = StatusFailed, row.Errors
+			report.Failed++
+			continue
+		}
+
+		result.Title = row.Book.Title
+		row.Book.UserID = userID
+		if row.Book.Genres == nil {
+			row.Book.Genres = []string{}
+		}
+
+		//AddError keeps the first message for a field, so a value that didn't parse isn't also called out of range
+		v := validator.New()
+		for field, message := range row.Errors {
+			v.AddError(field, message)
+		}
+
+		if data.ValidateBook(v, row.Book); !v.Valid() {
+			result.Status, result.Errors = StatusFailed, v.Errors
+			report.Failed++
+			continue
+		}
+
+		if id, ok := existing.find(row.Book); ok {
+			result.Status, result.BookID = StatusSkipped, id
+			result.Reason = fmt.Sprintf("already in the reading list as book %d", id)
+			report.Skipped++
+			continue
+		}
+
+		if line, ok := seen.find(row.Book); ok {
+			result.Status, result.Reason = StatusSkipped, fmt.Sprintf("same book as line %d", line)
+			report.Skipped++
+			continue
+		}
+		seen.add(row.Book, int64(row.Line))
+
+		result.Status = StatusValid
+		valid = append(valid, i)
+	}
+
+	if opts.DryRun || report.RolledBack() {
+		return report, nil
+	}
+
+	//an all or nothing import is one batch, so one transaction
+	size := len(valid)
+	if opts.BestEffort {
+		size = batchSize
+	}
+
+	for len(valid) > 0 {
+		batch := valid[:min(size, len(valid))]
+		valid = valid[len(batch):]
+
+		toSave := make([]*data.Book, len(batch))
+		for j, i := range batch {
+			toSave[j] = rows[i].Book
+		}
+
+		//earlier batches of a best effort import stay saved if this one fails
+		if err := books.InsertMany(ctx, toSave, actor); err != nil {
+			if !opts.BestEffort {
+				return nil, err
+			}
+
+			for _, i := range append(batch, valid...) {
+				report.Rows[i].Status, report.Rows[i].Reason = StatusFailed, err.Error()
+				report.Failed++
+			}
+			return report, err
+		}
+
+		for j, i := range batch {
+			report.Rows[i].Status, report.Rows[i].BookID = StatusCreated, toSave[j].ID
+			report.Created++
+		}
+	}
+
+	return report, nil
+}
+
+// library finds the book a row is the same as. Two books are the same when their titles match,
+// ignoring case and spacing, and so do their years, unless one of them has no year: StoryGraph
+// exports never do and it would be no use if those never matched anything
+type library map[string][]libraryEntry
+
+type libraryEntry struct {
+	published int
+	id        int64 //book id, or line for the rows of the file being imported
+}
+
+func titleKey(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+func (l library) add(book *data.Book, id int64) {
+	key := titleKey(book.Title)
+	l[key] = append(l[key], libraryEntry{published: book.Published, id: id})
+}
+
+func (l library) find(book *data.Book) (int64, bool) {
+	for _, entry := range l[titleKey(book.Title)] {
+		if entry.published == book.Published || entry.published == 0 || book.Published == 0 {
+			return entry.id, true
+		}
+	}
+	return 0, false
+}
+
+// existingBooks collects the books already in the reading list, a page at a time
+func existingBooks(ctx context.Context, books data.BookStore, userID int64) (library, error) {
+	existing := make(library)
+
+	filters := data.Filters{
+		Page:         1,
+		PageSize:     100,
+		Sort:         []string{"id"},
+		SortSafelist: []string{"id"},
+	}
+
+	for {
+		page, _, err := books.GetAll(ctx, userID, filters)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, book := range page {
+			existing.add(book, book.ID)
+		}
+
+		if len(page) < filters.PageSize {
+			return existing, nil
+		}
+		filters.Page++
+	}
+}
+
+// tooMany is checked by the parsers as they read, so a huge file is turned down without reading it all
+func tooMany(rows []Row) error {
+	if len(rows) >= MaxRows {
+		return ErrTooManyRows
+	}
+	return nil
+}
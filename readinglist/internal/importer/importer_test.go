@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"readinglist.github.io/internal/data"
+)
+
+// failingStore fails the InsertMany calls after the first ok ones
+type failingStore struct {
+	data.BookStore
+	ok int
+}
+
+var errSaving = errors.New("database went away")
+
+func (s *failingStore) InsertMany(ctx context.Context, books []*data.Book, actor data.Actor) error {
+	if s.ok == 0 {
+		return errSaving
+	}
+	s.ok--
+	return s.BookStore.InsertMany(ctx, books, actor)
+}
+
+func TestImportBestEffortBatchFails(t *testing.T) {
+	rows := make([]Row, 2*batchSize+50)
+	for i := range rows {
+		rows[i] = Row{Line: i + 2, Book: &data.Book{Title: fmt.Sprintf("Book %d", i), Genres: []string{}}}
+	}
+
+	books := &failingStore{BookStore: data.NewMemoryBookModel(), ok: 1}
+
+	report, err := Import(context.Background(), books, 1, data.Actor{UserID: 1}, rows, Options{BestEffort: true})
+	if !errors.Is(err, errSaving) {
+		t.Fatalf("got error %v, want %v", err, errSaving)
+	}
+	if report == nil {
+		t.Fatal("got no report")
+	}
+
+	if report.Created != batchSize || report.Failed != len(rows)-batchSize {
+		t.Fatalf("got created=%d failed=%d, want %d and %d", report.Created, report.Failed, batchSize, len(rows)-batchSize)
+	}
+
+	for i, result := range report.Rows {
+		switch {
+		case i < batchSize && (result.Status != StatusCreated || result.BookID == 0):
+			t.Errorf("row %d: got %+v, want it created", i, result)
+		case i >= batchSize && (result.Status != StatusFailed || result.Reason != errSaving.Error()):
+			t.Errorf("row %d: got %+v, want it failed with the error", i, result)
+		}
+	}
+
+	_, metadata, err := books.GetAll(context.Background(), 1, data.Filters{Page: 1, PageSize: 1, Sort: []string{"id"}, SortSafelist: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.TotalRecords != batchSize {
+		t.Errorf("got %d books saved, want the first batch of %d", metadata.TotalRecords, batchSize)
+	}
+}
+
+func TestImportAllOrNothingSaveFails(t *testing.T) {
+	rows := []Row{{Line: 2, Book: &data.Book{Title: "Dune", Genres: []string{}}}}
+
+	report, err := Import(context.Background(), &failingStore{BookStore: data.NewMemoryBookModel()}, 1, data.Actor{}, rows, Options{})
+	if !errors.Is(err, errSaving) || report != nil {
+		t.Fatalf("got %+v and %v, want no report and %v", report, err, errSaving)
+	}
+}
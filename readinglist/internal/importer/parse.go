@@ -0,0 +1,248 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"readinglist.github.io/internal/data"
+)
+
+// csvColumns are the columns a CSV import may have, in any order. Only title is required
+var csvColumns = []string{"title", "published", "pages", "genres", "rating"}
+
+// ParseCSV reads a CSV file with a header row naming its columns, e.g.
+//
+//	title,published,pages,genres,rating
+//	Dune,1965,412,"scifi,classic",4.5
+//
+// genres are comma separated within their field and any empty field means the book doesn't have it
+func ParseCSV(r io.Reader) ([]Row, error) {
+	check := func(columns map[string]int) error {
+		for name := range columns {
+			if !slices.Contains(csvColumns, name) {
+				return fmt.Errorf("has an unknown column %q, the columns are %s", name, strings.Join(csvColumns, ", "))
+			}
+		}
+
+		if _, ok := columns["title"]; !ok {
+			return errors.New("must have a title column")
+		}
+
+		return nil
+	}
+
+	return readRecords(r, check, csvRow)
+}
+
+// readRecords reads a CSV file whose first row names the columns. check vets the columns, named in
+// lower case, before any record is read and row turns each record into a Row. field gives the trimmed
+// value of a column in the record, or "" if the file doesn't have it
+func readRecords(r io.Reader, check func(columns map[string]int) error, row func(line int, field func(name string) string) Row) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("must have a header row")
+		}
+		return nil, csvError(err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) //spreadsheets like to add a BOM
+
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("has the column %q more than once", name)
+		}
+		columns[name] = i
+	}
+
+	if err := check(columns); err != nil {
+		return nil, err
+	}
+
+	rows := []Row{}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		//a short or long record can still be reported on its own, anything else means we've lost our place
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, csvError(err)
+		}
+
+		line, _ := reader.FieldPos(0) //only safe once the record was read, a broken one has no fields
+
+		if err := tooMany(rows); err != nil {
+			return nil, err
+		}
+
+		if err != nil {
+			rows = append(rows, Row{Line: line, Errors: map[string]string{
+				"row": fmt.Sprintf("has %d fields but the header has %d", len(record), len(header)),
+			}})
+			continue
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		rows = append(rows, row(line, field))
+	}
+}
+
+// csvError turns a broken record, e.g. an unterminated quote, into an error about the file rather
+// than one about the reader, so it is reported like any other problem with the body
+func csvError(err error) error {
+	var parseError *csv.ParseError
+	if errors.As(err, &parseError) {
+		return fmt.Errorf("has a malformed record on line %d: %w", parseError.StartLine, parseError.Err)
+	}
+	return err
+}
+
+// csvRow converts the fields of one record, a field that won't convert is recorded against its column
+func csvRow(line int, field func(string) string) Row {
+	row := Row{Line: line, Book: &data.Book{Title: field("title")}}
+	errs := make(map[string]string)
+
+	var err error
+
+	if s := field("published"); s != "" {
+		if row.Book.Published, err = strconv.Atoi(s); err != nil {
+			errs["published"] = "must be an integer value"
+		}
+	}
+
+	if s := field("pages"); s != "" {
+		if row.Book.Pages, err = strconv.Atoi(s); err != nil {
+			errs["pages"] = "must be an integer value"
+		}
+	}
+
+	row.Book.Genres = splitList(field("genres"))
+
+	if s := field("rating"); s != "" {
+		rating, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			errs["rating"] = "must be a number"
+		}
+		row.Book.Rating = float32(rating)
+	}
+
+	if len(errs) > 0 {
+		row.Errors = errs
+	}
+
+	return row
+}
+
+// ndjsonRecord is one line of an NDJSON import, the same fields as creating a book
+type ndjsonRecord struct {
+	Title     string   `json:"title"`
+	Published int      `json:"published"`
+	Pages     int      `json:"pages"`
+	Genres    []string `json:"genres"`
+	Rating    float32  `json:"rating"`
+}
+
+// ParseNDJSON reads newline delimited JSON, one book object per line. Blank lines are ignored
+func ParseNDJSON(r io.Reader) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	rows := []Row{}
+
+	for line := 1; scanner.Scan(); line++ {
+		js := bytes.TrimSpace(scanner.Bytes())
+		if len(js) == 0 {
+			continue
+		}
+
+		if err := tooMany(rows); err != nil {
+			return nil, err
+		}
+
+		var record ndjsonRecord
+
+		if msg := decodeLine(js, &record); msg != nil {
+			rows = append(rows, Row{Line: line, Errors: msg})
+			continue
+		}
+
+		rows = append(rows, Row{Line: line, Book: &data.Book{
+			Title:     record.Title,
+			Published: record.Published,
+			Pages:     record.Pages,
+			Genres:    record.Genres,
+			Rating:    record.Rating,
+		}})
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, errors.New("has a line longer than 1MB")
+		}
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// decodeLine decodes one line strictly, the errors are keyed by field where we know it
+func decodeLine(js []byte, record *ndjsonRecord) map[string]string {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(record)
+	if err == nil && dec.More() {
+		err = errors.New("must hold exactly one JSON object")
+	}
+	if err == nil {
+		return nil
+	}
+
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var syntaxError *json.SyntaxError
+
+	switch {
+	case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+		return map[string]string{unmarshalTypeError.Field: "has the wrong JSON type"}
+	case errors.As(err, &unmarshalTypeError):
+		return map[string]string{"row": "must be a JSON object"}
+	case errors.As(err, &syntaxError):
+		return map[string]string{"row": fmt.Sprintf("is badly-formed JSON (at character %d)", syntaxError.Offset)}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return map[string]string{"row": "has an unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")}
+	default:
+		return map[string]string{"row": strings.TrimPrefix(err.Error(), "json: ")}
+	}
+}
+
+// splitList splits a comma separated field, dropping empty values
+func splitList(s string) []string {
+	values := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
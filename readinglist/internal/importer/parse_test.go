@@ -0,0 +1,110 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCSVMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty", "", "must have a header row"},
+		{"unterminated quote", "title\n\"abc\n", "has a malformed record on line 2"},
+		{"bare quote", "title,pages\nDune,412\na\"b,1\n", "has a malformed record on line 3"},
+		{"broken header", "\"title\n", "has a malformed record on line 1"},
+		{"unknown column", "title,author\nDune,Herbert\n", `has an unknown column "author"`},
+		{"no title", "pages\n412\n", "must have a title column"},
+		{"repeated column", "title,Title\nDune,Dune\n", `has the column "title" more than once`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCSV(strings.NewReader(tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSVRowErrors(t *testing.T) {
+	body := "title,published,rating\n" +
+		"Dune,1965,4.5\n" +
+		"Short\n" +
+		"Emma,eighteen,x\n"
+
+	rows, err := ParseCSV(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	if rows[0].Line != 2 || rows[0].Errors != nil || rows[0].Book.Published != 1965 {
+		t.Errorf("Dune: got %+v", rows[0])
+	}
+
+	if short := rows[1]; short.Line != 3 || short.Book != nil || short.Errors["row"] != "has 1 fields but the header has 3" {
+		t.Errorf("short record: got %+v, want it reported on line 3", short)
+	}
+
+	emma := rows[2]
+	if emma.Errors["published"] != "must be an integer value" || emma.Errors["rating"] != "must be a number" {
+		t.Errorf("Emma: got errors %v", emma.Errors)
+	}
+}
+
+func TestParseNDJSON(t *testing.T) {
+	body := `{"title": "Dune", "published": 1965, "genres": ["sci-fi"]}` + "\n" +
+		"\n" +
+		`{"title": "Emma", "pages": "lots"}` + "\n" +
+		`{"title": "Emma", "author": "Austen"}` + "\n" +
+		`{"title": ` + "\n" +
+		`["Dune"]` + "\n" +
+		`{"title": "Dune"} {"title": "Emma"}` + "\n"
+
+	rows, err := ParseNDJSON(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 6 {
+		t.Fatalf("got %d rows, want 6", len(rows))
+	}
+
+	if dune := rows[0]; dune.Line != 1 || dune.Errors != nil || dune.Book.Title != "Dune" || dune.Book.Published != 1965 {
+		t.Errorf("Dune: got %+v", dune)
+	}
+
+	tests := []struct {
+		line  int
+		field string
+		want  string
+	}{
+		{3, "pages", "has the wrong JSON type"},
+		{4, "row", `has an unknown field "author"`},
+		{5, "row", "unexpected EOF"},
+		{6, "row", "must be a JSON object"},
+		{7, "row", "must hold exactly one JSON object"},
+	}
+
+	for i, tt := range tests {
+		row := rows[i+1]
+		if row.Line != tt.line || row.Book != nil || row.Errors[tt.field] != tt.want {
+			t.Errorf("line %d: got %+v, want %s %q", tt.line, row, tt.field, tt.want)
+		}
+	}
+}
+
+func TestParseNDJSONLineTooLong(t *testing.T) {
+	body := `{"title": "` + strings.Repeat("a", 1024*1024) + `"}`
+
+	if _, err := ParseNDJSON(strings.NewReader(body)); err == nil || err.Error() != "has a line longer than 1MB" {
+		t.Errorf("got error %v, want the line to be too long", err)
+	}
+}
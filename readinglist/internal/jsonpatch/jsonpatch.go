@@ -0,0 +1,299 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902) documents to
+// decoded JSON, i.e. the map[string]any / []any / float64 / string / bool / nil values that
+// encoding/json produces when decoding into an any
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrTestFailed is returned when a "test" operation doesn't match, the document is left unchanged
+var ErrTestFailed = errors.New("test operation failed")
+
+// Operation is one entry in a JSON Patch document
+type Operation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value"`
+}
+
+// OperationError says which operation of a patch failed and why
+type OperationError struct {
+	Index int //position of the operation in the patch, from 0
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// MergePatch applies an RFC 7396 merge patch: objects are merged key by key, a null removes
+// the key and anything else replaces the target outright
+func MergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = MergePatch(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+// Apply runs the operations in order and returns the patched document. It supports add, remove,
+// replace, move, copy and test. A patch is all or nothing, on error the result should be thrown away
+func Apply(doc any, ops []Operation) (any, error) {
+	for i, op := range ops {
+		var err error
+
+		switch op.Op {
+		case "add":
+			doc, err = add(doc, op.Path, deepCopy(op.Value))
+		case "remove":
+			doc, _, err = remove(doc, op.Path)
+		case "replace":
+			if doc, _, err = remove(doc, op.Path); err == nil {
+				doc, err = add(doc, op.Path, deepCopy(op.Value))
+			}
+		case "move":
+			var value any
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				err = errors.New("can't move a value into itself")
+			} else if doc, value, err = remove(doc, op.From); err == nil {
+				doc, err = add(doc, op.Path, value)
+			}
+		case "copy":
+			var value any
+			if value, err = get(doc, op.From); err == nil {
+				doc, err = add(doc, op.Path, deepCopy(value))
+			}
+		case "test":
+			var value any
+			if value, err = get(doc, op.Path); err == nil && !equal(value, op.Value) {
+				err = ErrTestFailed
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+
+		if err != nil {
+			return nil, &OperationError{Index: i, Op: op.Op, Path: op.Path, Err: err}
+		}
+	}
+
+	return doc, nil
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped tokens, "" is the whole document
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex parses a token used against an array, max is the largest index allowed.
+// An index is only digits, Atoi would also take a sign
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || strings.Trim(token, "0123456789") != "" || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+
+	return i, nil
+}
+
+func get(doc any, pointer string) (any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", pointer)
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+	}
+
+	return doc, nil
+}
+
+// add sets the value at pointer, inserting into an array rather than overwriting, "-" appends
+func add(doc any, pointer string, value any) (any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return update(doc, tokens, pointer, func(parent any, last string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[last] = value
+			return node, nil
+		case []any:
+			i := len(node)
+			if last != "-" {
+				if i, err = arrayIndex(last, len(node)); err != nil {
+					return nil, err
+				}
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+	})
+}
+
+// remove deletes the value at pointer and returns it
+func remove(doc any, pointer string) (any, any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed any
+
+	doc, err = update(doc, tokens, pointer, func(parent any, last string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			value, ok := node[last]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", pointer)
+			}
+			removed = value
+			delete(node, last)
+			return node, nil
+		case []any:
+			i, err := arrayIndex(last, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+	})
+
+	return doc, removed, err
+}
+
+// update walks to the parent of the last token and lets fn change it. Arrays can be reallocated
+// by fn, so the new parent is written back into its own parent on the way out
+func update(doc any, tokens []string, pointer string, fn func(parent any, last string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+		child, err := update(child, tokens[1:], pointer, fn)
+		if err != nil {
+			return nil, err
+		}
+		node[tokens[0]] = child
+		return node, nil
+	case []any:
+		i, err := arrayIndex(tokens[0], len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(node[i], tokens[1:], pointer, fn)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, fmt.Errorf("path %q does not exist", pointer)
+	}
+}
+
+// equal compares two decoded JSON values, numbers are all float64 so 1 and 1.0 match
+func equal(a, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// deepCopy stops a value added twice (e.g. by copy) from being shared between two places
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, child := range v {
+			m[key] = deepCopy(child)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, child := range v {
+			s[i] = deepCopy(child)
+		}
+		return s
+	default:
+		return v
+	}
+}
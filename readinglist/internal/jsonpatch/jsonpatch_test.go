@@ -0,0 +1,298 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const book = `{"title": "Dune", "published": 1965, "genres": ["sci-fi", "classics"], "rating": 4.5}`
+
+// decode turns a JSON literal into the values encoding/json gives an any
+func decode(t *testing.T, js string) any {
+	t.Helper()
+
+	var v any
+	if err := json.Unmarshal([]byte(js), &v); err != nil {
+		t.Fatalf("decoding %s: %v", js, err)
+	}
+	return v
+}
+
+// assertJSON compares got with want as JSON, object keys come out sorted so the order doesn't matter
+func assertJSON(t *testing.T, got any, want string) {
+	t.Helper()
+
+	gotJS, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJS, err := json.Marshal(decode(t, want))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(gotJS) != string(wantJS) {
+		t.Errorf("got %s, want %s", gotJS, wantJS)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string //the patched document, or the error it should fail with
+	}{
+		{
+			name:  "add inserts into an array",
+			patch: `[{"op": "add", "path": "/genres/1", "value": "space"}]`,
+			want:  `{"title": "Dune", "published": 1965, "genres": ["sci-fi", "space", "classics"], "rating": 4.5}`,
+		},
+		{
+			name:  "add at the length of an array appends",
+			patch: `[{"op": "add", "path": "/genres/2", "value": "space"}]`,
+			want:  `{"title": "Dune", "published": 1965, "genres": ["sci-fi", "classics", "space"], "rating": 4.5}`,
+		},
+		{
+			name:  "add with - appends",
+			patch: `[{"op": "add", "path": "/genres/-", "value": "space"}]`,
+			want:  `{"title": "Dune", "published": 1965, "genres": ["sci-fi", "classics", "space"], "rating": 4.5}`,
+		},
+		{
+			name:  "add replaces a member",
+			patch: `[{"op": "add", "path": "/genres", "value": []}]`,
+			want:  `{"title": "Dune", "published": 1965, "genres": [], "rating": 4.5}`,
+		},
+		{
+			name:  "add to a missing parent",
+			patch: `[{"op": "add", "path": "/series/name", "value": "Dune"}]`,
+			want:  `path "/series/name" does not exist`,
+		},
+		{
+			name:  "remove from an array",
+			patch: `[{"op": "remove", "path": "/genres/0"}]`,
+			want:  `{"title": "Dune", "published": 1965, "genres": ["classics"], "rating": 4.5}`,
+		},
+		{
+			name:  "remove a member",
+			patch: `[{"op": "remove", "path": "/rating"}]`,
+			want:  `{"title": "Dune", "published": 1965, "genres": ["sci-fi", "classics"]}`,
+		},
+		{
+			name:  "remove a missing member",
+			patch: `[{"op": "remove", "path": "/pages"}]`,
+			want:  `path "/pages" does not exist`,
+		},
+		{
+			name:  "remove with - has nothing to remove",
+			patch: `[{"op": "remove", "path": "/genres/-"}]`,
+			want:  `invalid array index "-"`,
+		},
+		{
+			name:  "replace an array element",
+			patch: `[{"op": "replace", "path": "/genres/1", "value": "classic"}]`,
+			want:  `{"title": "Dune", "published": 1965, "genres": ["sci-fi", "classic"], "rating": 4.5}`,
+		},
+		{
+			name:  "replace a missing member",
+			patch: `[{"op": "replace", "path": "/pages", "value": 412}]`,
+			want:  `path "/pages" does not exist`,
+		},
+		{
+			name:  "move within an array",
+			patch: `[{"op": "move", "from": "/genres/0", "path": "/genres/1"}]`,
+			want:  `{"title": "Dune", "published": 1965, "genres": ["classics", "sci-fi"], "rating": 4.5}`,
+		},
+		{
+			name:  "move a member",
+			patch: `[{"op": "move", "from": "/genres/0", "path": "/category"}]`,
+			want:  `{"title": "Dune", "published": 1965, "genres": ["classics"], "category": "sci-fi", "rating": 4.5}`,
+		},
+		{
+			name:  "move a value into its own child",
+			patch: `[{"op": "move", "from": "/genres", "path": "/genres/0"}]`,
+			want:  "can't move a value into itself",
+		},
+		{
+			name:  "move a value onto itself",
+			patch: `[{"op": "move", "from": "/genres", "path": "/genres"}]`,
+			want:  book,
+		},
+		{
+			name:  "copy an array element",
+			patch: `[{"op": "copy", "from": "/genres/1", "path": "/genres/0"}]`,
+			want:  `{"title": "Dune", "published": 1965, "genres": ["classics", "sci-fi", "classics"], "rating": 4.5}`,
+		},
+		{
+			name:  "copy doesn't share the value",
+			doc:   `{"a": {"b": 1}}`,
+			patch: `[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "replace", "path": "/c/b", "value": 2}]`,
+			want:  `{"a": {"b": 1}, "c": {"b": 2}}`,
+		},
+		{
+			name:  "test an array",
+			patch: `[{"op": "test", "path": "/genres", "value": ["sci-fi", "classics"]}, {"op": "remove", "path": "/genres/1"}]`,
+			want:  `{"title": "Dune", "published": 1965, "genres": ["sci-fi"], "rating": 4.5}`,
+		},
+		{
+			name:  "test an element",
+			patch: `[{"op": "test", "path": "/genres/1", "value": "classics"}]`,
+			want:  book,
+		},
+		{
+			name:  "test a number written differently",
+			patch: `[{"op": "test", "path": "/published", "value": 1965.0}]`,
+			want:  book,
+		},
+		{
+			name:  "test that doesn't match",
+			patch: `[{"op": "test", "path": "/genres", "value": ["classics", "sci-fi"]}]`,
+			want:  ErrTestFailed.Error(),
+		},
+		{
+			name:  "leading zero index",
+			patch: `[{"op": "replace", "path": "/genres/01", "value": "classic"}]`,
+			want:  `invalid array index "01"`,
+		},
+		{
+			name:  "signed index",
+			patch: `[{"op": "remove", "path": "/genres/+1"}]`,
+			want:  `invalid array index "+1"`,
+		},
+		{
+			name:  "negative index",
+			patch: `[{"op": "remove", "path": "/genres/-1"}]`,
+			want:  `invalid array index "-1"`,
+		},
+		{
+			name:  "index past the end",
+			patch: `[{"op": "remove", "path": "/genres/2"}]`,
+			want:  "array index 2 out of range",
+		},
+		{
+			name:  "add past the length",
+			patch: `[{"op": "add", "path": "/genres/3", "value": "space"}]`,
+			want:  "array index 3 out of range",
+		},
+		{
+			name:  "~1 is a slash",
+			doc:   `{"a/b": 1}`,
+			patch: `[{"op": "replace", "path": "/a~1b", "value": 2}]`,
+			want:  `{"a/b": 2}`,
+		},
+		{
+			name:  "~0 is a tilde",
+			doc:   `{"~1": 1, "/": 2}`,
+			patch: `[{"op": "remove", "path": "/~01"}]`,
+			want:  `{"/": 2}`,
+		},
+		{
+			name:  "path without a leading slash",
+			patch: `[{"op": "remove", "path": "genres"}]`,
+			want:  `path "genres" must start with /`,
+		},
+		{
+			name:  "unknown op",
+			patch: `[{"op": "increment", "path": "/rating"}]`,
+			want:  `unknown op "increment"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.doc == "" {
+				tt.doc = book
+			}
+
+			var ops []Operation
+			if err := json.Unmarshal([]byte(tt.patch), &ops); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Apply(decode(t, tt.doc), ops)
+
+			if !strings.HasPrefix(tt.want, "{") {
+				if err == nil || !strings.HasSuffix(err.Error(), tt.want) {
+					t.Fatalf("got error %v, want %q", err, tt.want)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyOperationError(t *testing.T) {
+	ops := []Operation{
+		{Op: "replace", Path: "/rating", Value: 4.0},
+		{Op: "test", Path: "/title", Value: "Emma"},
+	}
+
+	_, err := Apply(decode(t, book), ops)
+
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.Index != 1 || opErr.Op != "test" || opErr.Path != "/title" {
+		t.Fatalf("got %v, want the second operation to fail", err)
+	}
+	if !errors.Is(err, ErrTestFailed) {
+		t.Errorf("got %v, want it to wrap ErrTestFailed", err)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "members are replaced",
+			patch: `{"rating": 5, "genres": ["classics"]}`,
+			want:  `{"title": "Dune", "published": 1965, "genres": ["classics"], "rating": 5}`,
+		},
+		{
+			name:  "null removes a member",
+			patch: `{"rating": null, "genres": null}`,
+			want:  `{"title": "Dune", "published": 1965}`,
+		},
+		{
+			name:  "null for a missing member does nothing",
+			patch: `{"pages": null}`,
+			want:  book,
+		},
+		{
+			name:  "objects are merged",
+			doc:   `{"a": {"b": 1, "c": 2}}`,
+			patch: `{"a": {"b": null, "d": 3}}`,
+			want:  `{"a": {"c": 2, "d": 3}}`,
+		},
+		{
+			name:  "nulls inside a new object are dropped",
+			doc:   `{}`,
+			patch: `{"a": {"b": null, "c": 1}}`,
+			want:  `{"a": {"c": 1}}`,
+		},
+		{
+			name:  "a non-object patch replaces the document",
+			patch: `["Dune"]`,
+			want:  `["Dune"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.doc == "" {
+				tt.doc = book
+			}
+
+			assertJSON(t, MergePatch(decode(t, tt.doc), decode(t, tt.patch)), tt.want)
+		})
+	}
+}
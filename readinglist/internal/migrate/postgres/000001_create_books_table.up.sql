@@ -0,0 +1,13 @@
+-- IF NOT EXISTS so databases created by hand with the old setupDB.sql can adopt migrations
+CREATE TABLE IF NOT EXISTS books (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    published integer NOT NULL,
+    pages integer NOT NULL,
+    genres text[] NOT NULL,
+    version integer NOT NULL DEFAULT 1,
+    rating FLOAT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS books_genres_idx ON books USING GIN (genres);
@@ -0,0 +1,9 @@
+-- emails are lower-cased by the application before they get here
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    email text UNIQUE NOT NULL,
+    password_hash bytea NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
@@ -0,0 +1,16 @@
+-- Books now belong to a user. Rows created before this migration are given to a
+-- placeholder "legacy" account that nobody can log in to (its password hash is empty).
+-- To hand them to a real user afterwards:
+--   UPDATE books SET user_id = <id> WHERE user_id = (SELECT id FROM users WHERE email = 'legacy@readinglist.invalid');
+INSERT INTO users (name, email, password_hash)
+SELECT 'Legacy books', 'legacy@readinglist.invalid', ''::bytea
+WHERE EXISTS (SELECT 1 FROM books);
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS user_id bigint REFERENCES users ON DELETE CASCADE;
+
+UPDATE books SET user_id = (SELECT id FROM users WHERE email = 'legacy@readinglist.invalid')
+WHERE user_id IS NULL;
+
+ALTER TABLE books ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS books_user_id_idx ON books (user_id);
@@ -0,0 +1,22 @@
+-- One row per change to a book. book_id has no foreign key so the history outlives the book,
+-- snapshot is the book's fields after the change (before it, for a delete)
+CREATE TABLE IF NOT EXISTS book_revisions (
+    id bigserial PRIMARY KEY,
+    book_id bigint NOT NULL,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    version integer NOT NULL,
+    action text NOT NULL,
+    snapshot jsonb NOT NULL,
+    actor_id bigint REFERENCES users ON DELETE SET NULL,
+    api_key_id bigint REFERENCES api_keys ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS book_revisions_book_id_version_idx ON book_revisions (book_id, version);
+
+-- existing books start their history with a baseline of how they look today, nobody to credit it to
+INSERT INTO book_revisions (book_id, user_id, version, action, snapshot, created_at)
+SELECT id, user_id, version, 'baseline',
+    jsonb_build_object('title', title, 'published', published, 'pages', pages, 'genres', to_jsonb(genres), 'rating', rating),
+    NOW()
+FROM books;
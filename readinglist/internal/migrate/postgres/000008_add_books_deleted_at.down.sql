@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS books_deleted_at_idx;
+
+-- without the column trashed books would come back, so they go for good
+DELETE FROM books WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE books DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,11 @@
+-- genres is a JSON array, SQLite has no array type
+CREATE TABLE IF NOT EXISTS books (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    title TEXT NOT NULL,
+    published INTEGER NOT NULL,
+    pages INTEGER NOT NULL,
+    genres TEXT NOT NULL DEFAULT '[]',
+    version INTEGER NOT NULL DEFAULT 1,
+    rating REAL NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS books_user_id_idx;
+
+ALTER TABLE books DROP COLUMN user_id;
+
+DELETE FROM users WHERE email = 'legacy@readinglist.invalid';
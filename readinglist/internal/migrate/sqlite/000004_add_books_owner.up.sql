@@ -0,0 +1,12 @@
+-- Books now belong to a user, see the postgres migration for how the legacy account works.
+-- SQLite can't add a NOT NULL column to an existing table, the application always sets it
+INSERT INTO users (name, email, password_hash)
+SELECT 'Legacy books', 'legacy@readinglist.invalid', X''
+WHERE EXISTS (SELECT 1 FROM books);
+
+ALTER TABLE books ADD COLUMN user_id INTEGER REFERENCES users ON DELETE CASCADE;
+
+UPDATE books SET user_id = (SELECT id FROM users WHERE email = 'legacy@readinglist.invalid')
+WHERE user_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS books_user_id_idx ON books (user_id);
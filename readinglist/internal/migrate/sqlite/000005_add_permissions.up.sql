@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS permissions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+INSERT INTO permissions (code)
+VALUES ('books:read'), ('books:write'), ('admin')
+ON CONFLICT DO NOTHING;
+
+-- everyone who registered before permissions existed keeps being able to use their reading list
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id
+FROM users, permissions
+WHERE permissions.code IN ('books:read', 'books:write')
+ON CONFLICT DO NOTHING;
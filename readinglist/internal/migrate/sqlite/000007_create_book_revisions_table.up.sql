@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS book_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    snapshot TEXT NOT NULL,
+    actor_id INTEGER REFERENCES users ON DELETE SET NULL,
+    api_key_id INTEGER REFERENCES api_keys ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS book_revisions_book_id_version_idx ON book_revisions (book_id, version);
+
+INSERT INTO book_revisions (book_id, user_id, version, action, snapshot)
+SELECT id, user_id, version, 'baseline',
+    json_object('title', title, 'published', published, 'pages', pages, 'genres', json(genres), 'rating', rating)
+FROM books;
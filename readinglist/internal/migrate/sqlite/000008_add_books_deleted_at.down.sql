@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS books_deleted_at_idx;
+
+DELETE FROM books WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE books DROP COLUMN deleted_at;
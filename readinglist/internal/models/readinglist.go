@@ -1,10 +1,12 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 )
 
 type Book struct {
@@ -21,15 +23,99 @@ type BookResponse struct {
 }
 
 type BooksResponse struct {
-	Books *[]Book `json:"books"`
+	Books    *[]Book  `json:"books"`
+	Metadata Metadata `json:"metadata"`
 }
 
+// Metadata is the paging information the API sends with a list of books
+type Metadata struct {
+	CurrentPage int `json:"current_page"`
+	LastPage    int `json:"last_page"` //0 when there are no books
+}
+
+// pageSize is the most books the API hands out per page
+const pageSize = 100
+
 type ReadingListModel struct {
 	Endpoint string
+	APIKey   string //sent as "Authorization: ApiKey ...", the API rejects anonymous calls to /v1/books
 }
 
+// NewRequest builds a request to the API with our credential attached
+func (m *ReadingListModel) NewRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+m.APIKey)
+	}
+
+	return req, nil
+}
+
+// get sends an authenticated GET to the API
+func (m *ReadingListModel) get(url string) (*http.Response, error) {
+	req, err := m.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
+// Ping checks the API is ready and accepts our credential. It asks the API's readiness check on the
+// same host as the endpoint, which the rate limiter lets through, so a busy probe can't use up the
+// requests our visitors need. A bad key is still turned away there
+func (m *ReadingListModel) Ping(ctx context.Context) error {
+	endpoint, err := url.Parse(m.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := m.NewRequest(http.MethodGet, endpoint.ResolveReference(&url.URL{Path: "/v1/health/ready"}).String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// GetAll fetches every book, a page at a time since the API won't send them all at once
 func (m *ReadingListModel) GetAll() (*[]Book, error) { //book slice (like a list)
-	resp, err := http.Get(m.Endpoint) //sends get call to API
+	books := []Book{}
+
+	for page := 1; ; page++ {
+		booksResp, err := m.getPage(page)
+		if err != nil {
+			return nil, err
+		}
+
+		if booksResp.Books != nil {
+			books = append(books, *booksResp.Books...)
+		}
+
+		if page >= booksResp.Metadata.LastPage {
+			return &books, nil
+		}
+	}
+}
+
+// getPage fetches one page of books
+func (m *ReadingListModel) getPage(page int) (*BooksResponse, error) {
+	url := fmt.Sprintf("%s?page=%d&page_size=%d", m.Endpoint, page, pageSize)
+	resp, err := m.get(url) //sends get call to API
 	if err != nil {
 		return nil, err
 	}
@@ -50,12 +136,12 @@ func (m *ReadingListModel) GetAll() (*[]Book, error) { //book slice (like a list
 		return nil, err
 	}
 
-	return booksResp.Books, nil
+	return &booksResp, nil
 }
 
 func (m *ReadingListModel) Get(id int64) (*Book, error) { //singular book returned
 	url := fmt.Sprintf("%s/%d", m.Endpoint, id) //generate the endpoint/uri
-	resp, err := http.Get(url)                  //sends get call to API
+	resp, err := m.get(url)                     //sends get call to API
 	if err != nil {
 		return nil, err
 	}
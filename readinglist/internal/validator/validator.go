@@ -0,0 +1,59 @@
+package validator
+
+import (
+	"regexp"
+	"slices"
+)
+
+// EmailRX is a sanity check for email addresses, not a full RFC 5322 parser
+var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+// Validator collects validation errors keyed by the field they belong to
+type Validator struct {
+	Errors map[string]string
+}
+
+// New returns a Validator with an empty error map
+func New() *Validator {
+	return &Validator{Errors: make(map[string]string)}
+}
+
+// Valid is true when no errors have been recorded
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// AddError records a message for a field, the first message for a field wins
+func (v *Validator) AddError(key, message string) {
+	if _, exists := v.Errors[key]; !exists {
+		v.Errors[key] = message
+	}
+}
+
+// Check adds the error only if the check failed
+func (v *Validator) Check(ok bool, key, message string) {
+	if !ok {
+		v.AddError(key, message)
+	}
+}
+
+// PermittedValue is true if value is one of the permitted values
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	return slices.Contains(permittedValues, value)
+}
+
+// Matches is true if the string matches the regex pattern
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
+
+// Unique is true if every value in the slice only shows up once
+func Unique[T comparable](values []T) bool {
+	uniqueValues := make(map[T]bool)
+
+	for _, value := range values {
+		uniqueValues[value] = true
+	}
+
+	return len(values) == len(uniqueValues)
+}